@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveTimeFormat names archived responses so they sort chronologically.
+const archiveTimeFormat = "20060102T150405.000Z"
+
+// responseArchive keeps every raw product API response, gzip-compressed, at
+// <dir>/<locale>/<product ID>/<fetch time>.json.gz so outputs can be rebuilt
+// after a parser fix without crawling again.
+type responseArchive struct {
+	dir string
+}
+
+type archiveEntry struct {
+	ID        string
+	Locale    string
+	FetchedAt time.Time
+	Path      string
+}
+
+func newResponseArchive(dir string) (*responseArchive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory %s: %v", dir, err)
+	}
+	return &responseArchive{dir: dir}, nil
+}
+
+func (a *responseArchive) save(locale, id string, body []byte, fetchedAt time.Time) (string, error) {
+	if id == "" || id != filepath.Base(id) {
+		return "", fmt.Errorf("invalid product ID %q", id)
+	}
+	productDir := filepath.Join(a.dir, locale, id)
+	if err := os.MkdirAll(productDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", productDir, err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = id + ".json"
+	zw.ModTime = fetchedAt
+	if _, err := zw.Write(body); err != nil {
+		return "", fmt.Errorf("failed to compress response for %s: %v", id, err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress response for %s: %v", id, err)
+	}
+
+	filename := filepath.Join(productDir, fetchedAt.UTC().Format(archiveTimeFormat)+".json.gz")
+	if err := writeFileAtomic(filename, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", filename, err)
+	}
+	return filename, nil
+}
+
+func (a *responseArchive) read(entry archiveEntry) ([]byte, error) {
+	file, err := os.Open(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", entry.Path, err)
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", entry.Path, err)
+	}
+	return body, nil
+}
+
+// latest returns the newest archived response of every product for locale,
+// ordered by product ID.
+func (a *responseArchive) latest(locale string) ([]archiveEntry, error) {
+	localeDir := filepath.Join(a.dir, locale)
+	products, err := os.ReadDir(localeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive %s: %v", localeDir, err)
+	}
+
+	var entries []archiveEntry
+	for _, product := range products {
+		if !product.IsDir() {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(localeDir, product.Name(), "*.json.gz"))
+		if err != nil || len(files) == 0 {
+			continue
+		}
+		sort.Strings(files)
+		newest := files[len(files)-1]
+		stamp := strings.TrimSuffix(filepath.Base(newest), ".json.gz")
+		fetchedAt, err := time.Parse(archiveTimeFormat, stamp)
+		if err != nil {
+			slog.Warn("Skipping archive file with unexpected name", "file", newest)
+			continue
+		}
+		entries = append(entries, archiveEntry{
+			ID:        product.Name(),
+			Locale:    locale,
+			FetchedAt: fetchedAt,
+			Path:      newest,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseArchiveLatest(t *testing.T) {
+	archive, err := newResponseArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2025, 6, 23, 9, 0, 0, 0, time.UTC)
+	responses := []struct {
+		id   string
+		at   time.Time
+		body string
+	}{
+		{"IA4845", first, `{"id":"IA4845","name":"old name","pricing_information":{"currentPrice":4400}}`},
+		{"IA4845", first.Add(time.Hour), `{"id":"IA4845","name":"new name","pricing_information":{"currentPrice":3900}}`},
+		{"HB9386", first, `{"id":"HB9386","name":"other","pricing_information":{"currentPrice":5000}}`},
+	}
+	for _, r := range responses {
+		if _, err := archive.save("ja-JP", r.id, []byte(r.body), r.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := archive.latest("ja-JP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != "HB9386" || entries[1].ID != "IA4845" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if !entries[1].FetchedAt.Equal(first.Add(time.Hour)) {
+		t.Errorf("IA4845 fetched at %s, want the newer response", entries[1].FetchedAt)
+	}
+
+	body, err := archive.read(entries[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	product, err := parseProduct(entries[1].ID, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "new name" || product.Price != "3900 JPY" {
+		t.Errorf("reparsed product = %s / %s", product.Name, product.Price)
+	}
+}
+
+func TestResponseArchiveRejectsPathIDs(t *testing.T) {
+	archive, err := newResponseArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.save("ja-JP", "../IA4845", []byte("{}"), time.Now()); err == nil {
+		t.Error("saved a response under a path-like ID")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runIDFormat names run directories by their UTC start time.
+const runIDFormat = "20060102T150405Z"
+
+// errorArtifact describes one failed request. The response body is stored
+// next to the index in BodyFile.
+type errorArtifact struct {
+	Seq       int           `json:"seq"`
+	ProductID string        `json:"product_id,omitempty"`
+	URL       string        `json:"url"`
+	Attempt   int           `json:"attempt"`
+	Status    int           `json:"status,omitempty"` // 0 for network errors
+	Error     string        `json:"error,omitempty"`
+	Challenge string        `json:"challenge,omitempty"` // detected bot challenge
+	Identity  string        `json:"identity,omitempty"`
+	Header    http.Header   `json:"header,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+	BodyFile  string        `json:"body_file,omitempty"`
+	BodyBytes int           `json:"body_bytes"`
+}
+
+// errorStore keeps the failed responses of one run in a directory: one body
+// file per failure and an index.jsonl line with the request details, so
+// blocked SKUs can be analyzed after the run. The directory is created on the
+// first failure.
+type errorStore struct {
+	mu    sync.Mutex
+	dir   string
+	count int
+}
+
+func newErrorStore(dir string) *errorStore {
+	return &errorStore{dir: dir}
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// record stores a failed request and returns the path of its body file.
+func (s *errorStore) record(a errorArtifact, body []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create error directory: %v", err)
+	}
+	s.count++
+	a.Seq = s.count
+	a.BodyBytes = len(body)
+
+	var bodyPath string
+	if len(body) > 0 {
+		subject := a.ProductID
+		if subject == "" {
+			subject = a.URL
+			if i := strings.Index(subject, "://"); i >= 0 {
+				subject = subject[i+3:]
+			}
+		}
+		subject = strings.Trim(unsafeFilenameChars.ReplaceAllString(subject, "_"), "_")
+		if len(subject) > 60 {
+			subject = subject[:60]
+		}
+		a.BodyFile = fmt.Sprintf("%04d_%s_%d_attempt%d%s", a.Seq, subject, a.Status, a.Attempt, bodyExtension(a.Header))
+		bodyPath = filepath.Join(s.dir, a.BodyFile)
+		if err := os.WriteFile(bodyPath, body, 0644); err != nil {
+			return "", fmt.Errorf("failed to save error body: %v", err)
+		}
+	}
+
+	line, err := json.Marshal(a)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode error artifact: %v", err)
+	}
+	index, err := os.OpenFile(filepath.Join(s.dir, "index.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open error index: %v", err)
+	}
+	defer index.Close()
+	if _, err := index.Write(append(line, '\n')); err != nil {
+		return "", fmt.Errorf("failed to write error index: %v", err)
+	}
+	return bodyPath, nil
+}
+
+func bodyExtension(header http.Header) string {
+	contentType := header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "json"):
+		return ".json"
+	case strings.Contains(contentType, "html"), contentType == "":
+		return ".html"
+	}
+	return ".txt"
+}
+
+// readErrorIndex loads the artifacts recorded in dir.
+func readErrorIndex(dir string) ([]errorArtifact, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "index.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error index: %v", err)
+	}
+	var artifacts []errorArtifact
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var a errorArtifact
+		if err := json.Unmarshal([]byte(line), &a); err != nil {
+			return nil, fmt.Errorf("error index line %d: %v", i+1, err)
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
+}
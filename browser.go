@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// BrowserOptions configures the headless browser that solves bot challenges.
+type BrowserOptions struct {
+	ExecPath string        // Chrome/Chromium binary; empty searches the usual locations
+	Headless bool          // false shows the window, useful when a challenge needs a click
+	Timeout  time.Duration // for the whole bootstrap
+	Settle   time.Duration // time given to challenge scripts after the page loaded
+	Proxy    string        // proxy server for the browser, e.g. http://10.0.0.1:8080
+}
+
+// cookieBootstrapper visits pageURL in a real browser and returns the cookies
+// the storefront set, so the HTTP client can carry them on.
+type cookieBootstrapper func(pageURL string, identity *browserIdentity) ([]*http.Cookie, error)
+
+// chromedpBootstrap returns a cookieBootstrapper that drives Chrome through
+// chromedp with the session identity's User-Agent and language.
+func chromedpBootstrap(opts BrowserOptions) cookieBootstrapper {
+	if opts.Timeout == 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	return func(pageURL string, identity *browserIdentity) ([]*http.Cookie, error) {
+		allocOpts := append(chromedp.DefaultExecAllocatorOptions[:],
+			chromedp.Flag("headless", opts.Headless),
+			chromedp.Flag("lang", "ja-JP"),
+			chromedp.UserAgent(identity.UserAgent),
+		)
+		if opts.ExecPath != "" {
+			allocOpts = append(allocOpts, chromedp.ExecPath(opts.ExecPath))
+		}
+		if opts.Proxy != "" {
+			allocOpts = append(allocOpts, chromedp.ProxyServer(opts.Proxy))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		defer cancel()
+		ctx, cancelAlloc := chromedp.NewExecAllocator(ctx, allocOpts...)
+		defer cancelAlloc()
+		ctx, cancelBrowser := chromedp.NewContext(ctx)
+		defer cancelBrowser()
+
+		var browserCookies []*network.Cookie
+		err := chromedp.Run(ctx,
+			network.Enable(),
+			network.SetExtraHTTPHeaders(network.Headers{"Accept-Language": identity.AcceptLanguage}),
+			chromedp.Navigate(pageURL),
+			chromedp.WaitReady("body"),
+			chromedp.Sleep(opts.Settle),
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				var err error
+				browserCookies, err = network.GetCookies().WithURLs([]string{pageURL}).Do(ctx)
+				return err
+			}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("browser bootstrap of %s failed: %v", pageURL, err)
+		}
+
+		cookies := make([]*http.Cookie, 0, len(browserCookies))
+		for _, c := range browserCookies {
+			cookie := &http.Cookie{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				Secure:   c.Secure,
+				HttpOnly: c.HTTPOnly,
+			}
+			if !c.Session && c.Expires > 0 {
+				cookie.Expires = time.Unix(int64(c.Expires), 0)
+			}
+			cookies = append(cookies, cookie)
+		}
+		return cookies, nil
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cassette modes for cassetteTransport.
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// cassetteInteraction is one recorded request/response pair. The body is
+// stored as text when possible, as base64 for compressed or binary bodies,
+// or loaded from BodyFile (relative to the cassette) so saved pages such as
+// response_page_*.html can be used as fixtures directly.
+type cassetteInteraction struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Status     int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+	BodyFile   string      `json:"body_file,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+// cassetteTransport is an http.RoundTripper that either records every
+// exchange made through the inner transport, or answers requests from a
+// cassette without touching the network. Replayed requests are matched by
+// method and URL; repeated requests get the recorded responses in order, the
+// last one repeating.
+type cassetteTransport struct {
+	mu       sync.Mutex
+	mode     string
+	path     string
+	inner    http.RoundTripper
+	cassette cassetteFile
+	replays  map[string][]int
+	served   map[string]int
+}
+
+func newCassetteTransport(mode, path string, inner http.RoundTripper) (*cassetteTransport, error) {
+	t := &cassetteTransport{
+		mode:    mode,
+		path:    path,
+		inner:   inner,
+		replays: make(map[string][]int),
+		served:  make(map[string]int),
+	}
+	switch mode {
+	case cassetteRecord:
+		return t, nil
+	case cassetteReplay:
+	default:
+		return nil, fmt.Errorf("unknown HTTP mode %q (want record or replay)", mode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &t.cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %v", path, err)
+	}
+	for i, interaction := range t.cassette.Interactions {
+		key, err := cassetteKey(interaction.Method, interaction.URL)
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s interaction %d: %v", path, i, err)
+		}
+		t.replays[key] = append(t.replays[key], i)
+	}
+	slog.Info("Loaded cassette", "file", path, "interactions", len(t.cassette.Interactions))
+	return t, nil
+}
+
+// cassetteKey normalizes the URL so hand-written cassettes may use either
+// decoded or percent-encoded paths.
+func cassetteKey(method, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method + " " + u.String(), nil
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == cassetteReplay {
+		return t.replay(req)
+	}
+	return t.record(req)
+}
+
+func (t *cassetteTransport) replay(req *http.Request) (*http.Response, error) {
+	key, _ := cassetteKey(req.Method, req.URL.String())
+
+	t.mu.Lock()
+	indexes := t.replays[key]
+	if len(indexes) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("cassette %s has no recorded response for %s", t.path, key)
+	}
+	n := t.served[key]
+	if n >= len(indexes) {
+		n = len(indexes) - 1
+	}
+	t.served[key]++
+	interaction := t.cassette.Interactions[indexes[n]]
+	t.mu.Unlock()
+
+	body, err := t.interactionBody(interaction)
+	if err != nil {
+		return nil, err
+	}
+	header := interaction.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *cassetteTransport) interactionBody(interaction cassetteInteraction) ([]byte, error) {
+	switch {
+	case interaction.BodyFile != "":
+		filename := interaction.BodyFile
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(filepath.Dir(t.path), filename)
+		}
+		return os.ReadFile(filename)
+	case interaction.BodyBase64 != "":
+		return base64.StdEncoding.DecodeString(interaction.BodyBase64)
+	}
+	return []byte(interaction.Body), nil
+}
+
+func (t *cassetteTransport) record(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := cassetteInteraction{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+	}
+	if resp.Header.Get("Content-Encoding") == "" && utf8.Valid(body) {
+		interaction.Body = string(body)
+	} else {
+		interaction.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	t.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// Close writes the recorded interactions to the cassette file and closes the
+// inner transport. Writing is skipped in replay mode.
+func (t *cassetteTransport) Close() error {
+	if closer, ok := t.inner.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if t.mode != cassetteRecord {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %v", err)
+	}
+	if dir := filepath.Dir(t.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(t.path, data); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %v", t.path, err)
+	}
+	slog.Info("Recorded cassette", "file", t.path, "interactions", len(t.cassette.Interactions))
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := newCassetteTransport(cassetteRecord, path, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: recorder}
+	for _, p := range []string{"/api/products/IA4845", "/api/products/IA4846"} {
+		resp, err := client.Get(server.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	player, err := newCassetteTransport(cassetteReplay, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: player}
+	resp, err := client.Get(server.URL + "/api/products/IA4846")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"path":"/api/products/IA4846"}` {
+		t.Errorf("replayed %d %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("replayed Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+
+	if _, err := client.Get(server.URL + "/api/products/HB9386"); err == nil {
+		t.Error("replay answered a request that was never recorded")
+	}
+}
+
+// TestOfflineDiscoverAndCrawl runs discovery and a crawl end to end against
+// the checked-in cassette, which serves the saved category pages and a
+// product response.
+func TestOfflineDiscoverAndCrawl(t *testing.T) {
+	dir := t.TempDir()
+	skuFile := filepath.Join(dir, "skus.txt")
+	replay := []string{"-http-mode", "replay", "-cassette", "testdata/cassettes/crawl.json"}
+
+	if err := runDiscover(append(replay, "-skus", skuFile, "-pages", "1")); err != nil {
+		t.Fatal(err)
+	}
+	discovered, err := readSKUs(skuFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discovered) == 0 {
+		t.Fatal("discovery found no SKUs in the recorded category pages")
+	}
+
+	if err := os.WriteFile(skuFile, []byte("IA4845\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	csvFile := filepath.Join(dir, "products.csv")
+	err = runCrawl(append(replay,
+		"-skus", skuFile,
+		"-csv-file", csvFile,
+		"-excel-file", filepath.Join(dir, "products.xlsx"),
+		"-archive-dir", filepath.Join(dir, "archive"),
+		"-state-file", filepath.Join(dir, "crawl_state.json"),
+		"-runs-dir", filepath.Join(dir, "runs"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][0] != "IA4845" || records[1][3] != "4400 JPY" {
+		t.Errorf("CSV records = %q", records)
+	}
+}
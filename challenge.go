@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// challengeSignature recognizes the block or challenge page of one bot
+// protection vendor by markers in its body or headers.
+type challengeSignature struct {
+	name    string
+	markers []string // any of these in the body (case-insensitive)
+	header  string   // or this response header being present
+}
+
+// challengeSignatures are checked in order. adidas.jp sits behind Akamai;
+// the others are kept so a CDN change is still recognized.
+var challengeSignatures = []challengeSignature{
+	{name: "akamai-challenge", markers: []string{"/_sec/cp_challenge/", "sec-if-cpt-container", "bm-verify"}},
+	{name: "akamai-access-denied", markers: []string{"errors.edgesuite.net", "errors&#46;edgesuite&#46;net", "reference&#32;&#35;"}},
+	{name: "perimeterx", markers: []string{"px-captcha", "captcha.px-cdn.net", "_pxappid"}},
+	{name: "datadome", markers: []string{"captcha-delivery.com"}, header: "X-Datadome"},
+	{name: "cloudflare", markers: []string{"cf-chl-", "challenge-platform", "<title>just a moment...</title>"}},
+}
+
+// detectChallenge reports whether a response is a bot challenge or block
+// page rather than an ordinary error, and which kind. Only 403, 429 and 503
+// responses, and HTML answers to API calls, are inspected.
+func detectChallenge(status int, header http.Header, body []byte, dest string) (string, bool) {
+	htmlForAPI := dest == destAPI && strings.Contains(header.Get("Content-Type"), "text/html")
+	switch {
+	case status == http.StatusForbidden, status == http.StatusTooManyRequests, status == http.StatusServiceUnavailable:
+	case status == http.StatusOK && htmlForAPI:
+	default:
+		return "", false
+	}
+
+	lower := bytes.ToLower(body)
+	for _, sig := range challengeSignatures {
+		if sig.header != "" && header.Get(sig.header) != "" {
+			return sig.name, true
+		}
+		for _, marker := range sig.markers {
+			if bytes.Contains(lower, []byte(marker)) {
+				return sig.name, true
+			}
+		}
+	}
+	if status == http.StatusForbidden && bytes.Contains(lower, []byte("<title>access denied</title>")) {
+		return "access-denied", true
+	}
+	return "", false
+}
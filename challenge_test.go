@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectChallengeFixtures(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	for _, tt := range []struct {
+		file   string
+		status int
+		want   string
+	}{
+		{"akamai_access_denied.html", http.StatusForbidden, "akamai-access-denied"},
+		{"akamai_bot_manager.html", http.StatusForbidden, "akamai-challenge"},
+		{"akamai_bot_manager.html", http.StatusOK, "akamai-challenge"},
+		{"perimeterx_captcha.html", http.StatusForbidden, "perimeterx"},
+		{"not_a_challenge_404.html", http.StatusNotFound, ""},
+		{"not_a_challenge_404.html", http.StatusForbidden, ""},
+	} {
+		body, err := os.ReadFile(filepath.Join("testdata", "challenges", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := detectChallenge(tt.status, html, body, destAPI)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s with %d: detected %q, %v; want %q", tt.file, tt.status, got, ok, tt.want)
+		}
+	}
+
+	// A plain 429 and a product response are not challenges, and HTML is
+	// expected when loading a page.
+	if kind, ok := detectChallenge(http.StatusTooManyRequests, html, []byte("Too Many Requests"), destAPI); ok {
+		t.Errorf("plain 429 detected as %s", kind)
+	}
+	product, _ := os.ReadFile(filepath.Join("testdata", "products", "IA4845.json"))
+	if kind, ok := detectChallenge(http.StatusOK, http.Header{"Content-Type": {"application/json"}}, product, destAPI); ok {
+		t.Errorf("product JSON detected as %s", kind)
+	}
+	page, _ := os.ReadFile("response_page_1750670934070873277.html")
+	if kind, ok := detectChallenge(http.StatusOK, html, page, destDocument); ok {
+		t.Errorf("category page detected as %s", kind)
+	}
+	if kind, ok := detectChallenge(http.StatusForbidden, http.Header{"X-Datadome": {"protected"}}, nil, destAPI); !ok || kind != "datadome" {
+		t.Errorf("DataDome header detected as %q, %v", kind, ok)
+	}
+}
+
+// TestChallengeBootstrapResumesCrawl checks that a challenge page makes the
+// session fetch cookies through its bootstrapper and retry at once with them.
+func TestChallengeBootstrapResumesCrawl(t *testing.T) {
+	m := newMockAdidas(t)
+	m.fail("/api/products/IA4845", m.botChallenge())
+	session, sleeps := newMockSession(m, 5*time.Second)
+
+	var visited []string
+	session.bootstrap = func(pageURL string, identity *browserIdentity) ([]*http.Cookie, error) {
+		visited = append(visited, pageURL)
+		if identity != session.identity {
+			t.Errorf("bootstrap used identity %s, session has %s", identity.Name, session.identity.Name)
+		}
+		return []*http.Cookie{{Name: "_abck", Value: "solved", Path: "/"}}, nil
+	}
+
+	if _, err := session.getProductDetails("IA4845"); err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 1 || visited[0] != m.URL()+"/" {
+		t.Errorf("bootstrap visited %v", visited)
+	}
+	if len(*sleeps) != 0 {
+		t.Errorf("slept %v after a solved challenge", *sleeps)
+	}
+	cookies := m.cookieHeaders("/api/products/IA4845")
+	if len(cookies) != 2 || cookies[0] != "" || !strings.Contains(cookies[1], "_abck=solved") {
+		t.Errorf("Cookie headers = %q", cookies)
+	}
+	artifacts, _ := readErrorIndex(session.errors.dir)
+	if len(artifacts) != 1 || artifacts[0].Challenge != "akamai-access-denied" || artifacts[0].Identity != session.identity.Name {
+		t.Errorf("error artifacts = %+v", artifacts)
+	}
+}
+
+func TestChallengeBootstrapGivesUp(t *testing.T) {
+	m := newMockAdidas(t)
+	challenge := m.botChallenge()
+	m.fail("/api/products/IA4845", challenge, challenge, challenge, challenge, challenge)
+	session, _ := newMockSession(m, 5*time.Second)
+
+	bootstraps := 0
+	session.bootstrap = func(string, *browserIdentity) ([]*http.Cookie, error) {
+		bootstraps++
+		return []*http.Cookie{{Name: "_abck", Value: "rejected", Path: "/"}}, nil
+	}
+	if _, err := session.getProductDetails("IA4845"); err == nil {
+		t.Fatal("persistent challenge did not fail the product")
+	}
+	if bootstraps != maxBootstraps {
+		t.Errorf("bootstraps = %d, want %d", bootstraps, maxBootstraps)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Color is a color label mapped onto the canonical palette. Labels holds
+// every label of the product that mapped to the same color, as listed; Name
+// is empty when a label matched no palette color.
+type Color struct {
+	Name   string   `json:"name,omitempty"`   // palette color, e.g. "Navy"
+	Family string   `json:"family,omitempty"` // hue family, e.g. "blue"
+	Hex    string   `json:"hex,omitempty"`    // representative value of the family
+	Labels []string `json:"labels"`
+}
+
+// paletteColor is one canonical color and the names it is known by. English
+// names are matched as whole words, Japanese names anywhere in the label.
+type paletteColor struct {
+	name, family string
+	english      []string
+	japanese     []string
+}
+
+var colorPalette = []paletteColor{
+	{"Black", "black", []string{"black", "noir"}, []string{"ブラック", "黒"}},
+	{"White", "white", []string{"white"}, []string{"ホワイト", "白"}},
+	{"Grey", "grey", []string{"grey", "gray", "charcoal", "onix"}, []string{"グレー", "グレイ", "チャコール", "灰"}},
+	{"Silver", "grey", []string{"silver"}, []string{"シルバー", "銀"}},
+	{"Red", "red", []string{"red", "scarlet", "crimson"}, []string{"レッド", "赤"}},
+	{"Burgundy", "red", []string{"burgundy", "maroon", "bordeaux"}, []string{"バーガンディ", "ボルドー", "マルーン"}},
+	{"Pink", "pink", []string{"pink", "magenta", "fuchsia"}, []string{"ピンク", "マゼンタ"}},
+	{"Orange", "orange", []string{"orange", "coral"}, []string{"オレンジ", "コーラル"}},
+	{"Yellow", "yellow", []string{"yellow", "lemon"}, []string{"イエロー", "黄"}},
+	{"Gold", "yellow", []string{"gold"}, []string{"ゴールド", "金"}},
+	{"Green", "green", []string{"green", "olive", "lime", "mint"}, []string{"グリーン", "オリーブ", "ライム", "ミント", "緑"}},
+	{"Khaki", "green", []string{"khaki"}, []string{"カーキ"}},
+	{"Blue", "blue", []string{"blue", "royal", "cyan", "turquoise", "teal"}, []string{"ブルー", "ターコイズ", "青"}},
+	{"Navy", "blue", []string{"navy", "ink"}, []string{"ネイビー", "紺"}},
+	{"Purple", "purple", []string{"purple", "violet", "lilac"}, []string{"パープル", "バイオレット", "ライラック", "紫"}},
+	{"Brown", "brown", []string{"brown", "chocolate", "mocha"}, []string{"ブラウン", "茶"}},
+	{"Beige", "brown", []string{"beige", "cream", "sand", "tan"}, []string{"ベージュ", "クリーム", "サンド"}},
+	{"Multicolor", "multi", []string{"multi", "multicolor", "multicolour"}, []string{"マルチカラー", "マルチ"}},
+}
+
+// colorFamilyHex gives the representative hex value of each hue family.
+var colorFamilyHex = map[string]string{
+	"black":  "#000000",
+	"white":  "#FFFFFF",
+	"grey":   "#808080",
+	"red":    "#D32F2F",
+	"pink":   "#F48FB1",
+	"orange": "#FB8C00",
+	"yellow": "#FDD835",
+	"green":  "#388E3C",
+	"blue":   "#1E88E5",
+	"purple": "#8E24AA",
+	"brown":  "#795548",
+	"multi":  "",
+}
+
+// matchColor finds the palette color of a label such as "Core Black",
+// "Collegiate Navy" or "ネイビーブルー". adidas puts the color last and
+// modifiers first, so English labels use their last word that names a color
+// ("Cream White" is White, "Grey Three" is Grey). Japanese labels use the
+// longest name they contain, so ネイビーブルー is Navy rather than Blue.
+func matchColor(label string) (paletteColor, bool) {
+	words := strings.FieldsFunc(strings.ToLower(label), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for i := len(words) - 1; i >= 0; i-- {
+		for _, c := range colorPalette {
+			if containsString(c.english, words[i]) {
+				return c, true
+			}
+		}
+	}
+
+	var best paletteColor
+	bestLen := 0
+	for _, c := range colorPalette {
+		for _, name := range c.japanese {
+			if len(name) > bestLen && strings.Contains(label, name) {
+				best, bestLen = c, len(name)
+			}
+		}
+	}
+	return best, bestLen > 0
+}
+
+// normalizeColors maps color labels onto the palette, merging labels that
+// name the same color. Labels that match nothing are kept as colors of
+// their own. The order of first appearance is preserved.
+func normalizeColors(labels []string) []Color {
+	var colors []Color
+	index := make(map[string]int)
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		key := "label:" + label
+		color := Color{}
+		if c, ok := matchColor(label); ok {
+			key = c.name
+			color = Color{Name: c.name, Family: c.family, Hex: colorFamilyHex[c.family]}
+		}
+		if i, seen := index[key]; seen {
+			if !containsString(colors[i].Labels, label) {
+				colors[i].Labels = append(colors[i].Labels, label)
+			}
+			continue
+		}
+		index[key] = len(colors)
+		color.Labels = []string{label}
+		colors = append(colors, color)
+	}
+	return colors
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeColors(t *testing.T) {
+	got := normalizeColors([]string{"Core Black", "ブラック", "ネイビーブルー", "Collegiate Navy", "ブルー", "Solar Slime", "ブラック"})
+	want := []Color{
+		{Name: "Black", Family: "black", Hex: "#000000", Labels: []string{"Core Black", "ブラック"}},
+		{Name: "Navy", Family: "blue", Hex: "#1E88E5", Labels: []string{"ネイビーブルー", "Collegiate Navy"}},
+		{Name: "Blue", Family: "blue", Hex: "#1E88E5", Labels: []string{"ブルー"}},
+		{Labels: []string{"Solar Slime"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeColors = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseProductDedupesColors(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "products", "KB5435.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseProduct("KB5435", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, c := range p.Colors {
+		if seen[c] {
+			t.Errorf("Colors %q lists %q twice", p.Colors, c)
+		}
+		seen[c] = true
+	}
+	var names []string
+	for _, c := range p.NormalizedColors {
+		names = append(names, c.Name)
+	}
+	if want := []string{"White", "Black", "Blue", "Pink"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("normalized color names = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	cmd, args := "crawl", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "crawl":
+		err = runCrawl(args)
+	case "discover":
+		err = runDiscover(args)
+	case "reparse":
+		err = runReparse(args)
+	case "categories":
+		err = runCategories(args)
+	case "extract-skus":
+		extractSKUsMain()
+	default:
+		err = fmt.Errorf("unknown command %q (want crawl, discover, reparse, categories or extract-skus)", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// sessionConfig holds the flags of commands that talk to the site.
+type sessionConfig struct {
+	baseURL   string
+	timeout   time.Duration
+	interval  time.Duration
+	jitter    time.Duration
+	httpMode  string
+	cassette  string
+	proxies   string
+	proxy     ProxyOptions
+	identity  string
+	browser   BrowserOptions
+	bootstrap bool
+	cookies   bool
+	cookieDir string
+	runsDir   string
+	runDir    string // set by newSession: runsDir/<start time>
+	metrics   string // address /metrics is served on, empty to disable
+	noRobots  bool   // -ignore-robots
+	robotsUA  string
+}
+
+func (c *sessionConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.baseURL, "base-url", "https://www.adidas.jp", "storefront the API requests go to")
+	fs.BoolVar(&c.noRobots, "ignore-robots", false, "do not fetch or obey robots.txt (disallow rules and crawl-delay); recorded in the run report")
+	fs.StringVar(&c.robotsUA, "robots-user-agent", "", "user agent robots.txt groups are matched against (default: the identity's User-Agent)")
+	fs.DurationVar(&c.timeout, "timeout", 30*time.Second, "timeout per HTTP request")
+	fs.DurationVar(&c.interval, "request-interval", 2*time.Second, "minimum delay between requests to the same host")
+	fs.DurationVar(&c.jitter, "request-jitter", 3*time.Second, "random extra delay added to -request-interval")
+	fs.StringVar(&c.httpMode, "http-mode", "", "record HTTP exchanges to the cassette (record) or serve them from it offline (replay)")
+	fs.StringVar(&c.cassette, "cassette", "testdata/cassettes/crawl.json", "cassette file used by -http-mode")
+	fs.StringVar(&c.identity, "identity", "random", "browser identity for the session: random or one of "+strings.Join(identityNames(), ", "))
+	fs.StringVar(&c.metrics, "metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090 (default: disabled)")
+	fs.StringVar(&c.runsDir, "runs-dir", "runs", "directory holding one subdirectory per run with its error responses")
+	fs.BoolVar(&c.cookies, "persist-cookies", true, "load cookies from and save them to -cookie-dir/<identity>.json across runs")
+	fs.StringVar(&c.cookieDir, "cookie-dir", "cookies", "directory of the per-identity cookie files")
+	fs.BoolVar(&c.bootstrap, "browser-bootstrap", true, "on a bot challenge, get fresh cookies by loading the storefront in Chrome (via chromedp)")
+	fs.StringVar(&c.browser.ExecPath, "chrome-path", "", "Chrome/Chromium binary for -browser-bootstrap (default: search PATH)")
+	fs.BoolVar(&c.browser.Headless, "browser-headless", true, "run the bootstrap browser without a window")
+	fs.DurationVar(&c.browser.Timeout, "browser-timeout", 60*time.Second, "time limit for one browser bootstrap")
+	fs.DurationVar(&c.browser.Settle, "browser-settle", 5*time.Second, "time given to challenge scripts after the page loaded")
+	fs.StringVar(&c.browser.Proxy, "browser-proxy", "", "proxy server for the bootstrap browser")
+	fs.StringVar(&c.proxies, "proxies", "", "comma-separated proxy URLs (http://, https:// or socks5://) to send requests through")
+	fs.StringVar(&c.proxy.File, "proxy-file", "", "file with one proxy URL per line")
+	fs.StringVar(&c.proxy.Strategy, "proxy-strategy", proxyRoundRobin, "proxy rotation: round-robin, sticky (one proxy until it is ejected) or least-failures")
+	fs.IntVar(&c.proxy.MaxFailures, "proxy-max-failures", 3, "consecutive 403/429/network failures before a proxy is ejected")
+	fs.DurationVar(&c.proxy.HealthInterval, "proxy-health-interval", 5*time.Minute, "how often every proxy is health checked; ejected proxies that pass are reinstated (0 disables)")
+	fs.StringVar(&c.proxy.HealthURL, "proxy-health-url", "", "URL fetched by proxy health checks (default: -base-url)")
+	fs.IntVar(&c.proxy.TrialAfter, "proxy-trial-after", 3, "health checks in a row an ejected proxy must answer with 403/429 before it gets a trial request")
+}
+
+func (c *sessionConfig) newSession() (*ScrapingSession, error) {
+	identity, err := lookupIdentity(c.identity)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Using browser identity", "identity", identity.Name)
+	opts := SessionOptions{BaseURL: c.baseURL, Timeout: c.timeout, Identity: identity}
+	if c.cookies && c.httpMode != cassetteReplay {
+		jar, err := loadCookieJar(cookieFile(c.cookieDir, identity))
+		if err != nil {
+			return nil, err
+		}
+		opts.Jar = jar
+	}
+	if (c.proxies != "" || c.proxy.File != "") && c.httpMode != cassetteReplay {
+		if c.proxies != "" {
+			c.proxy.URLs = strings.Split(c.proxies, ",")
+		}
+		if c.proxy.HealthURL == "" {
+			c.proxy.HealthURL = c.baseURL
+		}
+		c.proxy.Identity = identity
+		pool, err := newProxyPool(c.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up proxies: %v", err)
+		}
+		slog.Info("Using proxies", "count", len(pool.proxies), "strategy", c.proxy.Strategy)
+		opts.Transport = pool
+	}
+	if c.httpMode != "" {
+		inner := opts.Transport
+		if inner == nil {
+			inner = http.DefaultTransport
+		}
+		transport, err := newCassetteTransport(c.httpMode, c.cassette, inner)
+		if err != nil {
+			if closer, ok := inner.(io.Closer); ok {
+				closer.Close()
+			}
+			return nil, err
+		}
+		opts.Transport = transport
+	}
+	session := NewScrapingSession(opts)
+	c.runDir = filepath.Join(c.runsDir, time.Now().UTC().Format(runIDFormat))
+	session.errors = newErrorStore(filepath.Join(c.runDir, "errors"))
+	session.limiter = newRateLimiter(c.interval, c.jitter)
+	if c.httpMode == cassetteReplay {
+		// Nothing to be polite to when answering from a cassette.
+		session.limiter = newRateLimiter(0, 0)
+	} else if c.bootstrap {
+		session.bootstrap = chromedpBootstrap(c.browser)
+	}
+	switch {
+	case c.noRobots:
+		slog.Warn("Ignoring robots.txt as requested by -ignore-robots")
+	case c.httpMode != cassetteReplay:
+		agent := c.robotsUA
+		if agent == "" {
+			agent = identity.UserAgent
+		}
+		session.robots = newRobotsPolicy(agent, identity, session.client, session.limiter)
+	}
+	return session, nil
+}
+
+// outputConfig holds the flags shared by every command that writes products.
+type outputConfig struct {
+	mode      string
+	excelFile string
+	csvFile   string
+	csv       CSVOptions
+	pg        PostgresOptions
+	classify  bool
+	taxonomy  string
+}
+
+func (c *outputConfig) register(fs *flag.FlagSet) {
+	c.csv = DefaultCSVOptions()
+	fs.StringVar(&c.mode, "mode", string(ModeUpsert), "how Excel/CSV outputs treat products already in the file: append, upsert or replace; in-place updates reach the CSV every 100 updates and at the end of the run, the Excel file only at the end")
+	fs.StringVar(&c.excelFile, "excel-file", "adidas_products.xlsx", "Excel output file")
+	fs.StringVar(&c.csvFile, "csv-file", "adidas_products.csv", "CSV output file")
+	fs.StringVar(&c.csv.ListDelimiter, "csv-list-delimiter", c.csv.ListDelimiter, "separator for list columns (sizes, colors, images, features) in the CSV")
+	fs.BoolVar(&c.csv.JSONLists, "csv-json-lists", false, "encode CSV list columns as JSON arrays instead of delimited strings")
+	fs.BoolVar(&c.csv.BOM, "csv-bom", false, "start new CSV files with a UTF-8 BOM so Excel detects the encoding")
+	fs.StringVar(&c.pg.DSN, "pg-dsn", "", "Postgres connection string; enables the Postgres output when set")
+	fs.StringVar(&c.pg.Schema, "pg-schema", "", "Postgres schema for the crawler tables (created if missing)")
+	fs.IntVar(&c.pg.BatchSize, "pg-batch-size", 50, "number of products per Postgres COPY batch")
+	fs.BoolVar(&c.classify, "classify-features", false, "extract material percentages and technology tags (AEROREADY, Primegreen, ...) from the product texts")
+	fs.StringVar(&c.taxonomy, "taxonomy-file", "categories.json", "category tree from the categories command, used for products the API sends without breadcrumbs")
+}
+
+// locations lists where the configured outputs are written.
+func (c *outputConfig) locations() map[string]string {
+	locations := map[string]string{"excel": c.excelFile, "csv": c.csvFile}
+	if c.pg.DSN != "" {
+		locations["postgres"] = postgresLocation(c.pg)
+	}
+	return locations
+}
+
+// enricher returns the steps applied to every parsed product before it is
+// written: the category path from the taxonomy for products without
+// breadcrumbs and, with -classify-features, feature classification.
+func (c *outputConfig) enricher() (func(*ProductData), error) {
+	taxonomy, err := loadTaxonomy(c.taxonomy)
+	if err != nil {
+		return nil, err
+	}
+	return func(p *ProductData) {
+		if len(p.CategoryPath) == 0 {
+			p.CategoryPath = taxonomy.trailOf(p.Category)
+		}
+		if c.classify {
+			classifyFeatures(p)
+		}
+	}, nil
+}
+
+// open creates the configured sinks. On error the sinks opened so far are
+// closed again.
+func (c *outputConfig) open() ([]ProductSink, error) {
+	mode, err := parseWriteMode(c.mode)
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []ProductSink
+	excelSink, err := newExcelSink(c.excelFile, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Excel file: %v", err)
+	}
+	sinks = append(sinks, excelSink)
+
+	csvSink, err := newCSVSink(c.csvFile, c.csv, mode)
+	if err != nil {
+		closeSinks(sinks)
+		return nil, fmt.Errorf("failed to initialize CSV file: %v", err)
+	}
+	sinks = append(sinks, csvSink)
+
+	if c.pg.DSN != "" {
+		pgSink, err := newPostgresSink(c.pg)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, fmt.Errorf("failed to initialize Postgres output: %v", err)
+		}
+		sinks = append(sinks, pgSink)
+	}
+	return sinks, nil
+}
+
+func writeToSinks(sinks []ProductSink, p *ProductData) {
+	for _, sink := range sinks {
+		if err := sink.WriteProduct(p); err != nil {
+			slog.Error("Failed to write product", "id", p.ID, "sink", sink.Name(), "error", err)
+			metrics.sinkErrors.WithLabelValues(sink.Name()).Inc()
+			continue
+		}
+		metrics.productsWritten.WithLabelValues(sink.Name()).Inc()
+	}
+}
+
+func runCrawl(args []string) error {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	var sess sessionConfig
+	sess.register(fs)
+	var out outputConfig
+	out.register(fs)
+	var logs logConfig
+	logs.register(fs)
+	skuFile := fs.String("skus", "skus_from_html.txt", "file with one product ID per line")
+	archive := fs.Bool("archive", true, "store every raw API response in the archive")
+	archiveDir := fs.String("archive-dir", "archive", "directory of the raw response archive")
+	httpCache := fs.Bool("http-cache", true, "keep API responses in an on-disk HTTP cache and revalidate them with conditional requests (not used with -http-mode)")
+	httpCacheDir := fs.String("http-cache-dir", "http_cache", "directory of the HTTP cache")
+	httpCacheMaxAge := fs.Duration("http-cache-max-age", 0, "treat cached responses as fresh for this long regardless of Cache-Control, for development (default: honor the server's headers)")
+	downloadImages := fs.Bool("images", false, "download product images into a content-addressed store")
+	imageOpts := ImageOptions{}
+	fs.StringVar(&imageOpts.Dir, "image-dir", "images", "directory for downloaded images and their manifest")
+	imageSizes := fs.String("image-sizes", "", "comma-separated image widths to download, e.g. 600,1200 (default: the listed size)")
+	var drift DriftOptions
+	fs.Float64Var(&drift.WarnRate, "schema-warn-rate", 0.01, "warn at the end of the run about product fields that are missing, null or of a changed type in at least this share of responses (0 disables)")
+	fs.Float64Var(&drift.FailRate, "schema-fail-rate", 0.5, "stop the crawl once a product field is missing, null or of a changed type in this share of responses (0 disables)")
+	fs.IntVar(&drift.MinResponses, "schema-min-responses", 10, "product responses checked before -schema-fail-rate applies")
+	warmUp := fs.Bool("warm-up", false, "visit storefront pages before the first API call")
+	warmUpPages := fs.String("warm-up-pages", "/,/メンズ-tシャツ", "comma-separated storefront paths visited by -warm-up")
+	stateFile := fs.String("state-file", "crawl_state.json", "per-product fetch times, price history and stock status kept across runs")
+	incremental := fs.Bool("incremental", false, "crawl only the products due for a refresh, most urgent first, up to -budget")
+	var schedule ScheduleOptions
+	fs.IntVar(&schedule.Budget, "budget", 500, "maximum products requested by an -incremental run (0 for no limit)")
+	fs.DurationVar(&schedule.HotInterval, "hot-interval", time.Hour, "refresh interval of sale, low-stock and price-volatile products in -incremental runs")
+	fs.DurationVar(&schedule.FullInterval, "full-interval", 24*time.Hour, "refresh interval of all other products in -incremental runs")
+	lastModFile := fs.String("lastmod-file", "sitemap_lastmod.json", "sitemap lastmods from discover -source sitemap; -incremental refreshes products modified since their last fetch first")
+	fs.Parse(args)
+	if err := logs.setup(); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	rand.Seed(started.UnixNano())
+	slog.Info("Starting Adidas API crawler")
+	if sess.metrics != "" {
+		srv, err := serveMetrics(sess.metrics)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+	}
+
+	ids, err := readSKUs(*skuFile)
+	if err != nil {
+		return fmt.Errorf("failed to read IDs: %v", err)
+	}
+	slog.Info("Loaded IDs", "file", *skuFile, "count", len(ids))
+	state, err := loadCrawlState(*stateFile)
+	if err != nil {
+		return err
+	}
+	known := ids
+	var summary *scheduleSummary
+	if *incremental {
+		lastMods, err := loadLastMod(*lastModFile)
+		if err != nil {
+			return err
+		}
+		var scheduled []scheduledProduct
+		scheduled, summary = state.schedule(ids, lastMods, schedule)
+		ids = make([]string, len(scheduled))
+		for i, p := range scheduled {
+			ids[i] = p.ID
+			slog.Debug("Scheduled product", "id", p.ID, "priority", p.Priority, "reason", p.Reason)
+		}
+	}
+
+	session, err := sess.newSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.drift = newDriftMonitor(drift)
+	if session.enrich, err = out.enricher(); err != nil {
+		return err
+	}
+	if *warmUp {
+		if err := session.warmUp(strings.Split(*warmUpPages, ",")); err != nil {
+			return err
+		}
+	}
+	if *archive {
+		if session.archive, err = newResponseArchive(*archiveDir); err != nil {
+			return err
+		}
+	}
+	if *httpCache && sess.httpMode == "" {
+		if session.cache, err = newHTTPCache(*httpCacheDir, *httpCacheMaxAge); err != nil {
+			return err
+		}
+		if *httpCacheMaxAge > 0 {
+			slog.Warn("Overriding HTTP cache freshness", "max_age", *httpCacheMaxAge)
+		}
+	}
+
+	sinks, err := out.open()
+	if err != nil {
+		return err
+	}
+	sinks = append(sinks, state)
+	defer func() { closeSinks(sinks) }()
+
+	if *downloadImages {
+		if *imageSizes != "" {
+			imageOpts.Sizes = strings.Split(*imageSizes, ",")
+		}
+		imgSink, err := newImageSink(session, imageOpts)
+		if err != nil {
+			return fmt.Errorf("failed to initialize image store: %v", err)
+		}
+		sinks = append(sinks, imgSink)
+	}
+
+	report := newRunReport(sess.runDir, started)
+	report.RobotsIgnored = sess.noRobots
+	report.Schedule = summary
+	written, failed := crawlProducts(session, ids, sinks, report)
+	state.attempted(failed)
+	slog.Info("Crawl finished", "written", written, "failed", len(failed))
+	if n := session.errors.count; n > 0 {
+		slog.Info("Saved failed responses", "count", n, "dir", session.errors.dir)
+	}
+
+	prev, err := loadPreviousReport(sess.runsDir, sess.runDir)
+	if err != nil {
+		slog.Warn("Ignoring previous run report", "error", err)
+	}
+	for name, location := range out.locations() {
+		report.Outputs[name] = location
+	}
+	if *archive {
+		report.Outputs["archive"] = *archiveDir
+	}
+	if session.cache != nil {
+		report.Outputs["http-cache"] = *httpCacheDir
+	}
+	report.Outputs["state"] = *stateFile
+	if *incremental {
+		report.carryOver(prev, known)
+	}
+	if *downloadImages {
+		report.Outputs["images"] = imageOpts.Dir
+	}
+	report.finish(session, ids, prev, time.Now())
+	if err := report.write(sess.runDir); err != nil {
+		return err
+	}
+	fmt.Print(report.text())
+	session.drift.warn()
+	return session.drift.exceeded()
+}
+
+// crawlProducts fetches every ID and writes the parsed products to sinks,
+// recording the outcome in report if it is not nil. It stops once schema
+// drift reaches -schema-fail-rate; the IDs left are recorded as not
+// attempted. It returns the number of products written and the IDs that
+// failed.
+func crawlProducts(session *ScrapingSession, ids []string, sinks []ProductSink, report *runReport) (int, []string) {
+	written := 0
+	var failed []string
+	for i, id := range ids {
+		if err := session.drift.exceeded(); err != nil {
+			slog.Error("Stopping the crawl", "error", err, "not_attempted", len(ids)-i)
+			if report != nil {
+				report.NotAttempted = ids[i:]
+			}
+			break
+		}
+		start := time.Now()
+		product, err := session.getProductDetails(id)
+		if err != nil {
+			slog.Error("Failed to fetch product", "id", id, "n", i+1, "total", len(ids), "error", err)
+			metrics.products.WithLabelValues("failed").Inc()
+			if report != nil {
+				report.recordFailure(id, err)
+			}
+			failed = append(failed, id)
+			continue
+		}
+		slog.Info("Fetched product", "id", id, "n", i+1, "total", len(ids), "duration", time.Since(start).Round(time.Millisecond))
+		metrics.products.WithLabelValues("ok").Inc()
+		if report != nil {
+			report.recordSuccess(product)
+		}
+		writeToSinks(sinks, product)
+		written++
+	}
+	return written, failed
+}
+
+// runDiscover collects product IDs from category listing pages or the
+// sitemaps over HTTP and appends the new ones to the SKU file.
+func runDiscover(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	var sess sessionConfig
+	sess.register(fs)
+	skuFile := fs.String("skus", "skus_from_html.txt", "file the discovered product IDs are appended to")
+	categories := fs.String("categories", strings.Join(defaultCategoryURLs, ","), "comma-separated category listing URLs")
+	categoryNames := fs.String("category-names", "", "comma-separated category names from -taxonomy-file, e.g. Tシャツ or メンズ/ウェア・服/Tシャツ; replaces -categories")
+	taxonomyFile := fs.String("taxonomy-file", "categories.json", "category tree written by the categories command")
+	source := fs.String("source", "categories", "where product IDs are found: categories (listing pages) or sitemap")
+	sitemaps := fs.String("sitemaps", "", "comma-separated sitemap URLs for -source sitemap (default: the sitemaps listed in robots.txt)")
+	lastModFile := fs.String("lastmod-file", "sitemap_lastmod.json", "file the sitemap lastmod of every product found is merged into")
+	pages := fs.Int("pages", 3, "listing pages to fetch per category")
+	var logs logConfig
+	logs.register(fs)
+	fs.Parse(args)
+	if err := logs.setup(); err != nil {
+		return err
+	}
+	if sess.metrics != "" {
+		srv, err := serveMetrics(sess.metrics)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+	}
+
+	existing, err := loadExistingSKUs(*skuFile)
+	if err != nil {
+		return err
+	}
+	slog.Info("Loaded existing SKUs", "file", *skuFile, "count", len(existing))
+
+	session, err := sess.newSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var skus []string
+	switch *source {
+	case "categories":
+		categoryURLs := strings.Split(*categories, ",")
+		if *categoryNames != "" {
+			if categoryURLs, err = selectCategories(*taxonomyFile, strings.Split(*categoryNames, ","), session.baseURL); err != nil {
+				return err
+			}
+		}
+		if skus, err = session.discoverSKUs(categoryURLs, *pages, existing); err != nil {
+			return err
+		}
+	case "sitemap":
+		var sitemapURLs []string
+		if *sitemaps != "" {
+			sitemapURLs = strings.Split(*sitemaps, ",")
+		}
+		products, err := session.discoverSitemaps(sitemapURLs)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			if !existing[p.ID] {
+				skus = append(skus, p.ID)
+			}
+		}
+		if err := saveLastMod(*lastModFile, products); err != nil {
+			return err
+		}
+		slog.Info("Found products in sitemaps", "products", len(products), "new", len(skus), "lastmod_file", *lastModFile)
+	default:
+		return fmt.Errorf("unknown discovery source %q (want categories or sitemap)", *source)
+	}
+	if err := appendSKUs(skus, *skuFile); err != nil {
+		return fmt.Errorf("failed to save SKUs: %v", err)
+	}
+	slog.Info("Appended new SKUs", "file", *skuFile, "count", len(skus))
+	return nil
+}
+
+// runReparse rebuilds the outputs from the newest archived response of each
+// product, without any network access.
+func runReparse(args []string) error {
+	fs := flag.NewFlagSet("reparse", flag.ExitOnError)
+	var out outputConfig
+	out.register(fs)
+	archiveDir := fs.String("archive-dir", "archive", "directory of the raw response archive")
+	locale := fs.String("locale", "ja-JP", "archive locale to reparse")
+	var logs logConfig
+	logs.register(fs)
+	fs.Parse(args)
+	if err := logs.setup(); err != nil {
+		return err
+	}
+
+	archive, err := newResponseArchive(*archiveDir)
+	if err != nil {
+		return err
+	}
+	entries, err := archive.latest(*locale)
+	if err != nil {
+		return err
+	}
+	slog.Info("Reparsing archived products", "dir", *archiveDir, "count", len(entries))
+
+	enrich, err := out.enricher()
+	if err != nil {
+		return err
+	}
+	sinks, err := out.open()
+	if err != nil {
+		return err
+	}
+	defer closeSinks(sinks)
+
+	failed := 0
+	for i, entry := range entries {
+		slog.Debug("Reparsing product", "id", entry.ID, "fetched_at", entry.FetchedAt.Format(time.RFC3339), "n", i+1, "total", len(entries))
+		body, err := archive.read(entry)
+		if err != nil {
+			slog.Error("Failed to read archive", "id", entry.ID, "error", err)
+			failed++
+			continue
+		}
+		product, err := parseProduct(entry.ID, body)
+		if err != nil {
+			slog.Error("Failed to parse product", "id", entry.ID, "error", err)
+			failed++
+			continue
+		}
+		enrich(product)
+		writeToSinks(sinks, product)
+	}
+	slog.Info("Reparse finished", "parsed", len(entries)-failed, "failed", failed)
+	return nil
+}
+
+// runCategories crawls the storefront's category listings and saves the
+// category tree for discover -category-names and the crawl's category paths.
+func runCategories(args []string) error {
+	fs := flag.NewFlagSet("categories", flag.ExitOnError)
+	var sess sessionConfig
+	sess.register(fs)
+	seeds := fs.String("seeds", strings.Join(defaultTaxonomySeeds, ","), "comma-separated storefront paths the category crawl starts from")
+	maxPages := fs.Int("max-pages", 200, "category pages to fetch at most")
+	taxonomyFile := fs.String("taxonomy-file", "categories.json", "file the category tree is written to")
+	var logs logConfig
+	logs.register(fs)
+	fs.Parse(args)
+	if err := logs.setup(); err != nil {
+		return err
+	}
+	if sess.metrics != "" {
+		srv, err := serveMetrics(sess.metrics)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+	}
+
+	session, err := sess.newSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	taxonomy, err := session.crawlTaxonomy(strings.Split(*seeds, ","), *maxPages)
+	if err != nil {
+		return err
+	}
+	if err := taxonomy.save(*taxonomyFile); err != nil {
+		return err
+	}
+	slog.Info("Saved categories", "file", *taxonomyFile, "count", len(taxonomy.Categories))
+	fmt.Print(taxonomy.text())
+	return nil
+}
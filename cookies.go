@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storedCookie is one cookie as saved in a cookie file.
+type storedCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Scheme   string    `json:"scheme"`
+	Host     string    `json:"host"`             // host the cookie was received from
+	Domain   string    `json:"domain,omitempty"` // empty for host-only cookies
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"` // zero for session cookies
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+}
+
+func (c storedCookie) key() string {
+	domain := c.Domain
+	if domain == "" {
+		domain = c.Host
+	}
+	return domain + ";" + c.Path + ";" + c.Name
+}
+
+func (c storedCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// persistentJar is an http.CookieJar that can be saved to and loaded from a
+// file. net/http/cookiejar cannot list its cookies, so persistentJar keeps
+// its own copy of everything set through it and replays that into a fresh
+// cookiejar when loading.
+type persistentJar struct {
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	file    string
+	cookies map[string]storedCookie
+	now     func() time.Time
+}
+
+// loadCookieJar returns a jar holding the unexpired cookies saved in
+// filename. A missing file gives an empty jar.
+func loadCookieJar(filename string) (*persistentJar, error) {
+	jar, _ := cookiejar.New(nil)
+	j := &persistentJar{jar: jar, file: filename, cookies: make(map[string]storedCookie), now: time.Now}
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookie file: %v", err)
+	}
+	var stored []storedCookie
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse cookie file %s: %v", filename, err)
+	}
+	now := j.now()
+	expired := 0
+	for _, c := range stored {
+		if c.expired(now) {
+			expired++
+			continue
+		}
+		u := &url.URL{Scheme: c.Scheme, Host: c.Host, Path: c.Path}
+		j.jar.SetCookies(u, []*http.Cookie{{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}})
+		j.cookies[c.key()] = c
+	}
+	slog.Info("Loaded cookies", "file", filename, "cookies", len(j.cookies), "expired", expired)
+	return j, nil
+}
+
+func (j *persistentJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	for _, c := range cookies {
+		stored := storedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Scheme:   u.Scheme,
+			Host:     u.Host,
+			Domain:   strings.TrimPrefix(c.Domain, "."),
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if stored.Path == "" || !strings.HasPrefix(stored.Path, "/") {
+			stored.Path = defaultCookiePath(u.Path)
+		}
+		switch {
+		case c.MaxAge < 0:
+			stored.Expires = now
+		case c.MaxAge > 0:
+			stored.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		if stored.expired(now) {
+			delete(j.cookies, stored.key())
+			continue
+		}
+		j.cookies[stored.key()] = stored
+	}
+}
+
+// defaultCookiePath is the path a cookie without a Path attribute applies
+// to (RFC 6265 section 5.1.4).
+func defaultCookiePath(urlPath string) string {
+	if urlPath == "" || urlPath[0] != '/' || strings.Count(urlPath, "/") == 1 {
+		return "/"
+	}
+	return path.Dir(urlPath)
+}
+
+// Save writes the unexpired cookies to the jar's file.
+func (j *persistentJar) Save() error {
+	j.mu.Lock()
+	now := j.now()
+	var stored []storedCookie
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			stored = append(stored, c)
+		}
+	}
+	j.mu.Unlock()
+	sort.Slice(stored, func(a, b int) bool { return stored[a].key() < stored[b].key() })
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cookies: %v", err)
+	}
+	if dir := filepath.Dir(j.file); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	// Not writeFileAtomic: cookies are credentials, so only the owner may
+	// read the file.
+	tmp := j.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cookie file %s: %v", j.file, err)
+	}
+	if err := os.Rename(tmp, j.file); err != nil {
+		return fmt.Errorf("failed to write cookie file %s: %v", j.file, err)
+	}
+	slog.Info("Saved cookies", "file", j.file, "cookies", len(stored))
+	return nil
+}
+
+// cookieFile is the cookie file of an identity. Each identity keeps its own
+// cookies, since cookies issued to one browser look suspicious when sent by
+// another.
+func cookieFile(dir string, identity *browserIdentity) string {
+	return filepath.Join(dir, identity.Name+".json")
+}
+
+// warmUp visits storefront pages the way a visitor arriving at the site
+// would, so the session has the cookies a browser would have before its
+// first API call.
+func (s *ScrapingSession) warmUp(paths []string) error {
+	for _, p := range paths {
+		pageURL := s.baseURL + "/" + strings.TrimPrefix(strings.TrimSpace(p), "/")
+		slog.Info("Warming up session", "url", pageURL)
+		if _, err := s.fetch(pageURL, 2, requestOptions{dest: destDocument}); err != nil {
+			return fmt.Errorf("failed to warm up session at %s: %v", pageURL, err)
+		}
+	}
+	return nil
+}
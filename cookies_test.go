@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPersistentJarSaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cookies", "chrome-windows.json")
+	jar, err := loadCookieJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	site, _ := url.Parse("https://www.adidas.jp/api/products/IA4845")
+	jar.SetCookies(site, []*http.Cookie{
+		{Name: "_abck", Value: "long-lived", Domain: ".adidas.jp", Path: "/", Expires: now.Add(365 * 24 * time.Hour)},
+		{Name: "bm_sz", Value: "short", Path: "/", MaxAge: 1},
+		{Name: "session", Value: "browser-session"},
+		{Name: "gone", Value: "x", Path: "/", Expires: now.Add(-time.Hour)},
+	})
+	// A later response deletes a cookie again.
+	jar.SetCookies(site, []*http.Cookie{{Name: "session", Value: "", Path: "/api/products", MaxAge: -1}})
+
+	if err := jar.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("cookie file mode = %v, %v", info.Mode(), err)
+	}
+
+	// Two seconds later bm_sz has expired.
+	loaded, err := loadCookieJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.now = func() time.Time { return now.Add(2 * time.Second) }
+	if err := loaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := loadCookieJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range reloaded.Cookies(site) {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	if strings.Join(names, ",") != "_abck=long-lived" {
+		t.Errorf("cookies after reload = %v", names)
+	}
+	// The domain cookie still applies to other hosts of the site.
+	if cookies := reloaded.Cookies(&url.URL{Scheme: "https", Host: "shop.adidas.jp", Path: "/"}); len(cookies) != 1 {
+		t.Errorf("shop.adidas.jp cookies = %v", cookies)
+	}
+}
+
+// TestWarmUpPersistsCookies warms a session up against the mock server and
+// checks that the next session of the same identity starts with the cookies,
+// while another identity does not.
+func TestWarmUpPersistsCookies(t *testing.T) {
+	m := newMockAdidas(t)
+	dir := t.TempDir()
+	chrome, _ := lookupIdentity("chrome-windows")
+	safari, _ := lookupIdentity("safari-iphone")
+
+	newSession := func(identity *browserIdentity) *ScrapingSession {
+		jar, err := loadCookieJar(cookieFile(dir, identity))
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, _ := newMockSession(m, 5*time.Second)
+		session.identity = identity
+		session.client.Jar = jar
+		return session
+	}
+
+	first := newSession(chrome)
+	if err := first.warmUp([]string{"/", "/メンズ-tシャツ"}); err != nil {
+		t.Fatal(err)
+	}
+	if m.requestCount("/") != 1 || m.requestCount("/メンズ-tシャツ") != 1 {
+		t.Errorf("warm-up requests: home %d, category %d", m.requestCount("/"), m.requestCount("/メンズ-tシャツ"))
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := newSession(chrome)
+	if _, err := second.getProductDetails("KB5435"); err != nil {
+		t.Fatal(err)
+	}
+	sent := m.cookieHeaders("/api/products/KB5435")
+	if len(sent) != 1 || !strings.Contains(sent[0], "geo_ctry=JP") || !strings.Contains(sent[0], "bm_sz=warm") {
+		t.Errorf("second run sent cookies %q", sent)
+	}
+
+	other := newSession(safari)
+	if _, err := other.getProductDetails("KB5435"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := m.cookieHeaders("/api/products/KB5435"); sent[1] != "" {
+		t.Errorf("Safari identity sent Chrome's cookies: %q", sent[1])
+	}
+}
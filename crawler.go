@@ -2,156 +2,486 @@ package main
 
 import (
 	"compress/gzip"
+	"compress/zlib"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/xuri/excelize/v2"
 )
 
-// ProductData structure 
+// ProductData is a parsed product as handed to the output sinks. The fields
+// up to ReviewCount are the original output columns; the rest carry the
+// remaining product API fields, and Extra anything the model does not know.
+// Features combines Functions, Fit, Materials and USPs.
 type ProductData struct {
-	ID             string   `json:"id"`
-	URL            string   `json:"url"`
-	Name           string   `json:"name"`
-	Price          string   `json:"price"`
-	Description    string   `json:"description"`
-	Images         []string `json:"images"`
-	Sizes          []string `json:"sizes"`
-	Colors         []string `json:"colors"`
-	Availability   string   `json:"availability"`
-	Brand          string   `json:"brand"`
-	Category       string   `json:"category"`
-	Features       []string `json:"features"`
-	RatingFitting  string   `json:"rating_fitting"`
-	RatingLength   string   `json:"rating_length"`
-	RatingQuality  string   `json:"rating_quality"`
-	RatingComfort  string   `json:"rating_comfort"`
-	AverageRating  string   `json:"average_rating"`
-	ReviewCount    string   `json:"review_count"`
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Name          string   `json:"name"`
+	Price         string   `json:"price"`
+	Description   string   `json:"description"`
+	Images        []string `json:"images"`
+	Sizes         []string `json:"sizes"`
+	Colors        []string `json:"colors"`
+	Availability  string   `json:"availability"`
+	Brand         string   `json:"brand"`
+	Category      string   `json:"category"`
+	Features      []string `json:"features"`
+	RatingFitting string   `json:"rating_fitting"`
+	RatingLength  string   `json:"rating_length"`
+	RatingQuality string   `json:"rating_quality"`
+	RatingComfort string   `json:"rating_comfort"`
+	AverageRating string   `json:"average_rating"`
+	ReviewCount   string   `json:"review_count"`
+
+	ModelNumber        string            `json:"model_number"`
+	ProductType        string            `json:"product_type"`
+	Subtitle           string            `json:"subtitle"`
+	Gender             string            `json:"gender"`
+	Sports             []string          `json:"sports"`
+	ProductTypes       []string          `json:"product_types"`
+	CurrentPrice       float64           `json:"current_price"`
+	StandardPrice      float64           `json:"standard_price"`
+	StandardPriceNoVAT float64           `json:"standard_price_no_vat"`
+	OnSale             bool              `json:"on_sale"`
+	Outlet             bool              `json:"outlet"`
+	Orderable          bool              `json:"orderable"`
+	PreviewEnd         string            `json:"preview_end"` // end of the preview window of upcoming products
+	BadgeText          string            `json:"badge_text"`
+	BadgeStyle         string            `json:"badge_style"`
+	SearchColor        string            `json:"search_color"`
+	SubBrand           string            `json:"sub_brand"`
+	SizeChartURL       string            `json:"size_chart_url"`
+	Sustainability     []string          `json:"sustainability"`
+	Breadcrumbs        []Breadcrumb      `json:"breadcrumbs"`
+	CareInstructions   []CareInstruction `json:"care_instructions"`
+	Variations         []Variation       `json:"variations"`
+	NormalizedSizes    []Size            `json:"normalized_sizes"`  // Sizes parsed by parseSize
+	NormalizedColors   []Color           `json:"normalized_colors"` // Colors mapped onto the palette
+	Functions          []string          `json:"functions"`
+	Fit                []string          `json:"fit"`
+	Materials          []string          `json:"materials"`
+	USPs               []string          `json:"usps"`
+	MaterialContent    []MaterialShare   `json:"material_content,omitempty"` // set by classifyFeatures
+	Technologies       []string          `json:"technologies,omitempty"`     // set by classifyFeatures
+	CategoryPath       []string          `json:"category_path"`              // gender -> type -> subtype, from the breadcrumbs
+	ColorVariations    []ColorVariation  `json:"color_variations"`
+	GalleryImages      []string          `json:"gallery_images"`
+	MetaTitle          string            `json:"meta_title"`
+	MetaDescription    string            `json:"meta_description"`
+	MetaKeywords       string            `json:"meta_keywords"`
+	CanonicalURL       string            `json:"canonical_url"`
+	Extra              map[string]any    `json:"extra,omitempty"` // unmodeled fields by JSON path
 }
 
 type ScrapingSession struct {
 	client     *http.Client
 	baseURL    string
-	userAgents []string
+	identity   *browserIdentity
+	limiter    *rateLimiter
+	locale     string
+	archive    *responseArchive // nil disables archiving of raw responses
+	sleep      func(time.Duration)
+	bootstrap  cookieBootstrapper // nil disables browser bootstraps on bot challenges
+	bootstraps int
+	errors     *errorStore        // nil discards failed responses
+	retried    map[string]int     // retries per product ID
+	drift      *driftMonitor      // nil skips schema checks of product responses
+	enrich     func(*ProductData) // nil leaves parsed products as they are
+	robots     *robotsPolicy      // nil skips robots.txt
+	cache      *httpCache         // nil downloads every response in full
+	unchanged  map[string]bool    // product IDs answered from the HTTP cache
 }
 
-func NewScrapingSession() *ScrapingSession {
-	jar, _ := cookiejar.New(nil)
+// SessionOptions customizes NewScrapingSession. The zero value talks to the
+// live site directly.
+type SessionOptions struct {
+	Transport http.RoundTripper // nil uses http.DefaultTransport
+	BaseURL   string            // defaults to https://www.adidas.jp
+	Timeout   time.Duration     // per request, defaults to 30s
+	Identity  *browserIdentity  // nil picks a random identity
+	Jar       http.CookieJar    // nil starts with an empty in-memory jar
+}
+
+func NewScrapingSession(opts SessionOptions) *ScrapingSession {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://www.adidas.jp"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Jar == nil {
+		opts.Jar, _ = cookiejar.New(nil)
+	}
 	client := &http.Client{
-		Jar:     jar,
-		Timeout: 30 * time.Second,
+		Jar:       opts.Jar,
+		Timeout:   opts.Timeout,
+		Transport: opts.Transport,
 	}
-	userAgents := []string{
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1",
+	if opts.Identity == nil {
+		opts.Identity, _ = lookupIdentity("random")
 	}
 	return &ScrapingSession{
-		client:     client,
-		baseURL:    "https://www.adidas.jp",
-		userAgents: userAgents,
+		client:    client,
+		baseURL:   strings.TrimSuffix(opts.BaseURL, "/"),
+		locale:    "ja-JP",
+		identity:  opts.Identity,
+		limiter:   newRateLimiter(2*time.Second, 3*time.Second),
+		sleep:     time.Sleep,
+		retried:   make(map[string]int),
+		unchanged: make(map[string]bool),
 	}
 }
 
-func (s *ScrapingSession) getRandomUserAgent() string {
-	return s.userAgents[rand.Intn(len(s.userAgents))]
+// Close saves a persistent cookie jar and releases the session's transport,
+// which for a recording cassette means writing it to disk.
+func (s *ScrapingSession) Close() error {
+	var err error
+	if jar, ok := s.client.Jar.(*persistentJar); ok {
+		err = jar.Save()
+	}
+	if closer, ok := s.client.Transport.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
-func (s *ScrapingSession) setCommonHeaders(req *http.Request) {
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("Accept-Language", "ja-JP,ja;q=0.9,en-US;q=0.8,en;q=0.7")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("User-Agent", s.getRandomUserAgent())
-	req.Header.Set("Sec-Fetch-Dest", "empty")
-	req.Header.Set("Sec-Fetch-Mode", "cors")
-	req.Header.Set("Sec-Fetch-Site", "same-origin")
-	req.Header.Set("Referer", s.baseURL+"/s/men/")
-	req.Header.Set("sec-ch-ua", `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`)
-	req.Header.Set("sec-ch-ua-mobile", "?0")
-	req.Header.Set("sec-ch-ua-platform", `"Windows"`)
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Pragma", "no-cache")
+// setCommonHeaders sets the session identity's headers for a request to
+// dest. Requests to other hosts than the storefront, such as images, are
+// sent as cross-site.
+func (s *ScrapingSession) setCommonHeaders(req *http.Request, dest string) {
+	site, referer := "same-origin", s.baseURL+"/s/men/"
+	if dest == destDocument {
+		referer = s.baseURL + "/"
+	}
+	if base, err := url.Parse(s.baseURL); err == nil && base.Host != req.URL.Host {
+		site = "cross-site"
+	}
+	s.identity.apply(req, dest, site, referer)
+}
+
+// requestOptions adjusts a single request made through fetch.
+type requestOptions struct {
+	dest      string // Sec-Fetch-Dest, defaults to an API call (destAPI)
+	accept    string // replaces the identity's Accept header for dest
+	productID string // recorded with failed responses
 }
 
 func (s *ScrapingSession) makeRequest(targetURL string, retries int) ([]byte, error) {
+	return s.fetch(targetURL, retries, requestOptions{})
+}
+
+// crawlError is a failed request or product with the class it is grouped
+// under in the run report: network, timeout, challenge, rate-limited,
+// forbidden, not-found, http-<status>, robots or parse.
+type crawlError struct {
+	class string
+	err   error
+}
+
+func (e *crawlError) Error() string { return e.err.Error() }
+
+// errorClass returns the class of a crawlError anywhere in err's chain, or
+// "other".
+func errorClass(err error) string {
+	var ce *crawlError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	return "other"
+}
+
+func statusErrorClass(status int) string {
+	switch status {
+	case http.StatusTooManyRequests:
+		return "rate-limited"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not-found"
+	}
+	return fmt.Sprintf("http-%d", status)
+}
+
+func networkErrorClass(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "network"
+}
+
+// retry counts a retry of the request for reason.
+func (s *ScrapingSession) retry(opts requestOptions, reason string) {
+	metrics.retries.WithLabelValues(reason).Inc()
+	if opts.productID != "" {
+		s.retried[opts.productID]++
+	}
+}
+
+// markUnchanged records that the product of a request was answered from the
+// HTTP cache.
+func (s *ScrapingSession) markUnchanged(opts requestOptions) {
+	if opts.productID != "" {
+		s.unchanged[opts.productID] = true
+	}
+}
+
+// fetch performs a GET with the session's headers, cookies and rate limiter,
+// retrying on network errors, 403 and 429. Bot challenge pages trigger a
+// browser bootstrap when the session has one. API responses go through the
+// session's HTTP cache: fresh ones are served without a request, stale ones
+// are revalidated with a conditional request. Errors are *crawlError.
+func (s *ScrapingSession) fetch(targetURL string, retries int, opts requestOptions) ([]byte, error) {
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse URL: %v", err)
 	}
 	targetURL = parsedURL.String()
+	logger := slog.With("url", targetURL)
+	if opts.productID != "" {
+		logger = logger.With("id", opts.productID)
+	}
+	dest := opts.dest
+	if dest == "" {
+		dest = destAPI
+	}
+	var cached *cacheEntry
+	if dest == destAPI {
+		cached = s.cache.lookup(targetURL)
+	}
+	if cached != nil && s.cache.fresh(cached) {
+		logger.Debug("Serving response from the HTTP cache", "stored_at", cached.StoredAt)
+		metrics.httpCache.WithLabelValues("fresh").Inc()
+		s.markUnchanged(opts)
+		return cached.Body, nil
+	}
+	if err := s.robots.check(parsedURL); err != nil {
+		logger.Warn("Skipping request", "reason", err)
+		metrics.robotsBlocked.WithLabelValues(parsedURL.Host).Inc()
+		return nil, &crawlError{"robots", err}
+	}
 
+	lastClass := "other"
 	for attempt := 1; attempt <= retries; attempt++ {
 		req, err := http.NewRequest("GET", targetURL, nil)
 		if err != nil {
 			return nil, err
 		}
-		s.setCommonHeaders(req)
+		s.setCommonHeaders(req, dest)
+		if opts.accept != "" {
+			req.Header.Set("Accept", opts.accept)
+		}
+		cached.conditional(req)
+
+		waited := s.limiter.wait(parsedURL.Host)
+		metrics.rateLimitWait.WithLabelValues(parsedURL.Host).Observe(waited.Seconds())
 
+		failure := errorArtifact{ProductID: opts.productID, URL: targetURL, Attempt: attempt, StartedAt: time.Now()}
 		resp, err := s.client.Do(req)
+		metrics.observeResponse(dest, resp, time.Since(failure.StartedAt))
 		if err != nil {
-			fmt.Printf("Attempt %d failed: %v\n", attempt, err)
+			failure.Error = err.Error()
+			failure.Duration = time.Since(failure.StartedAt)
+			logger.Warn("Request failed", "attempt", attempt, "duration", failure.Duration, "error", err)
+			s.saveError(failure, nil)
 			if attempt < retries {
-				time.Sleep(time.Duration(3+rand.Intn(3)) * time.Second)
+				s.retry(opts, "network")
+				s.sleep(time.Duration(3+rand.Intn(3)) * time.Second)
 				continue
 			}
-			return nil, err
+			return nil, &crawlError{networkErrorClass(err), err}
 		}
 		defer resp.Body.Close()
+		resp.Body = countingBody{resp.Body, metrics.responseBytes.WithLabelValues(dest)}
+
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			logger.Debug("Response not modified", "attempt", attempt, "duration", time.Since(failure.StartedAt))
+			metrics.httpCache.WithLabelValues("not-modified").Inc()
+			if err := s.cache.revalidate(cached, resp.Header); err != nil {
+				logger.Warn("Failed to update HTTP cache", "error", err)
+			}
+			s.markUnchanged(opts)
+			return cached.Body, nil
+		}
 
 		if resp.StatusCode == http.StatusOK {
-			fmt.Printf("Attempt %d: Status OK\n", attempt)
-			body, err := s.readResponseBody(resp)
+			body, err := readResponseBody(resp)
 			if err != nil {
 				return nil, fmt.Errorf("failed to read response body: %v", err)
 			}
-			return body, nil
+			kind, challenged := detectChallenge(resp.StatusCode, resp.Header, body, dest)
+			if !challenged {
+				logger.Debug("Request succeeded", "attempt", attempt, "status", resp.StatusCode,
+					"duration", time.Since(failure.StartedAt), "bytes", len(body))
+				if dest == destAPI && s.cache != nil {
+					if stored, err := s.cache.store(targetURL, resp.Header, body); err != nil {
+						logger.Warn("Failed to update HTTP cache", "error", err)
+					} else if stored {
+						metrics.httpCache.WithLabelValues("stored").Inc()
+					}
+				}
+				return body, nil
+			}
+			failure.Status, failure.Header, failure.Challenge = resp.StatusCode, resp.Header, kind
+			failure.Duration = time.Since(failure.StartedAt)
+			logger.Warn("Got challenge page instead of content", "attempt", attempt, "status", resp.StatusCode,
+				"duration", failure.Duration, "challenge", kind)
+			s.saveError(failure, body)
+			metrics.challenges.WithLabelValues(kind).Inc()
+			if s.solveChallenge(kind) {
+				s.retry(opts, "challenge")
+				continue
+			}
+			return nil, &crawlError{"challenge", fmt.Errorf("blocked by %s challenge", kind)}
 		}
 
-		fmt.Printf("Attempt %d: Status %d\n", attempt, resp.StatusCode)
-		body, _ := io.ReadAll(resp.Body)
-		errorFile := fmt.Sprintf("error_%d_attempt_%d.html", resp.StatusCode, attempt)
-		if err := os.WriteFile(errorFile, body, 0644); err != nil {
-			fmt.Printf("Failed to save error file %s: %v\n", errorFile, err)
-		} else {
-			fmt.Printf("Saved error response to %s\n", errorFile)
+		body, err := readResponseBody(resp)
+		if err != nil {
+			logger.Warn("Failed to decode error response", "attempt", attempt, "error", err)
+		}
+		failure.Status, failure.Header = resp.StatusCode, resp.Header
+		failure.Duration = time.Since(failure.StartedAt)
+		kind, challenged := detectChallenge(resp.StatusCode, resp.Header, body, dest)
+		failure.Challenge = kind
+		errorFile := s.saveError(failure, body)
+		logger.Warn("Request failed", "attempt", attempt, "status", resp.StatusCode,
+			"duration", failure.Duration, "challenge", kind, "artifact", errorFile)
+
+		lastClass = statusErrorClass(resp.StatusCode)
+		if challenged {
+			lastClass = "challenge"
+			metrics.challenges.WithLabelValues(kind).Inc()
+			if s.solveChallenge(kind) {
+				s.retry(opts, "challenge")
+				continue
+			}
 		}
 
 		if resp.StatusCode == http.StatusTooManyRequests {
-			fmt.Println("Rate limit hit, waiting longer...")
-			time.Sleep(time.Duration(10+rand.Intn(5)) * time.Second)
+			wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			if !ok {
+				wait = time.Duration(10+rand.Intn(5)) * time.Second
+			}
+			logger.Info("Rate limited, backing off", "attempt", attempt, "wait", wait)
+			s.retry(opts, "429")
+			s.sleep(wait)
 			continue
 		} else if resp.StatusCode == http.StatusForbidden {
-			fmt.Printf("403 Forbidden: Check %s for details\n", errorFile)
-			time.Sleep(time.Duration(5+rand.Intn(5)) * time.Second)
+			wait := time.Duration(5+rand.Intn(5)) * time.Second
+			logger.Info("Forbidden, backing off", "attempt", attempt, "wait", wait)
+			s.retry(opts, "403")
+			s.sleep(wait)
 			continue
 		}
 
-		return nil, fmt.Errorf("failed with status: %d", resp.StatusCode)
+		return nil, &crawlError{lastClass, fmt.Errorf("failed with status: %d", resp.StatusCode)}
 	}
-	return nil, fmt.Errorf("all %d attempts failed", retries)
+	return nil, &crawlError{lastClass, fmt.Errorf("all %d attempts failed", retries)}
 }
 
-func (s *ScrapingSession) readResponseBody(resp *http.Response) ([]byte, error) {
+// saveError records a failed attempt in the session's error store, if it has
+// one, and returns the path of the saved body.
+func (s *ScrapingSession) saveError(failure errorArtifact, body []byte) string {
+	if s.errors == nil {
+		return ""
+	}
+	failure.Identity = s.identity.Name
+	path, err := s.errors.record(failure, body)
+	if err != nil {
+		slog.Error("Failed to save error response", "url", failure.URL, "error", err)
+		return ""
+	}
+	return path
+}
+
+// maxBootstraps caps browser bootstraps per session, so a challenge the
+// browser cannot pass does not launch Chrome for every product.
+const maxBootstraps = 3
+
+// solveChallenge opens the storefront home page in the session's browser
+// bootstrapper and moves the cookies it obtained into the session's jar. It
+// reports whether the request should be retried right away.
+func (s *ScrapingSession) solveChallenge(kind string) bool {
+	if s.bootstrap == nil || s.bootstraps >= maxBootstraps {
+		return false
+	}
+	s.bootstraps++
+	home := s.baseURL + "/"
+	slog.Info("Bootstrapping session in a browser", "url", home, "challenge", kind,
+		"bootstrap", s.bootstraps, "max_bootstraps", maxBootstraps)
+	cookies, err := s.bootstrap(home, s.identity)
+	if err != nil {
+		slog.Error("Browser bootstrap failed", "error", err)
+		return false
+	}
+	if len(cookies) == 0 {
+		slog.Warn("Browser bootstrap returned no cookies")
+		return false
+	}
+	homeURL, err := url.Parse(home)
+	if err != nil {
+		return false
+	}
+	s.client.Jar.SetCookies(homeURL, cookies)
+	slog.Info("Loaded cookies from the browser, resuming requests", "cookies", len(cookies))
+	return true
+}
+
+// parseRetryAfter interprets a Retry-After header given either in seconds or
+// as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// readResponseBody reads the body of resp, decoding the Content-Encoding the
+// identities offer.
+func readResponseBody(resp *http.Response) ([]byte, error) {
 	var reader io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "gzip" {
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
 		gzipReader, err := gzip.NewReader(resp.Body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create gzip reader: %v", err)
 		}
 		defer gzipReader.Close()
 		reader = gzipReader
+	case "deflate":
+		zlibReader, err := zlib.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create deflate reader: %v", err)
+		}
+		defer zlibReader.Close()
+		reader = zlibReader
+	case "br":
+		reader = brotli.NewReader(resp.Body)
 	}
 	body, err := io.ReadAll(reader)
 	if err != nil {
@@ -178,48 +508,40 @@ func readSKUs(filename string) ([]string, error) {
 
 func (s *ScrapingSession) getProductDetails(id string) (*ProductData, error) {
 	apiURL := fmt.Sprintf("%s/api/products/%s", s.baseURL, id)
-	body, err := s.makeRequest(apiURL, 5)
+	body, err := s.fetch(apiURL, 5, requestOptions{productID: id})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch product %s: %v", id, err)
-	}
-
-	fmt.Printf("Raw JSON response for ID %s:\n%s\n", id, string(body))
-
-	var data struct {
-		ID          string `json:"id"`
-		Name        string `json:"name"`
-		MetaData    struct {
-			Description string `json:"description"`
-		} `json:"meta_data"`
-		ProductListingAssets []struct {
-			ImageURL string `json:"image_url"`
-		} `json:"product_listing_assets"`
-		AttributeList struct {
-			Brand        string   `json:"brand"`
-			Color        string   `json:"color"`
-			Category     string   `json:"category"`
-			Functions    []string `json:"functions"`
-			ProductFit   []string `json:"productfit"`
-			BaseMaterial []string `json:"base_material"`
-			IsOrderable  bool     `json:"is_orderable"`
-		} `json:"attribute_list"`
-		PricingInformation struct {
-			CurrentPrice float64 `json:"currentPrice"`
-		} `json:"pricing_information"`
-		ProductDescription struct {
-			Text string   `json:"text"`
-			Usps []string `json:"usps"`
-		} `json:"product_description"`
-		VariationList []struct {
-			SKU  string `json:"sku"`
-			Size string `json:"size"`
-		} `json:"variation_list"`
-		ProductLinkList []struct {
-			SearchColor  string `json:"search_color"`
-			DefaultColor string `json:"default_color"`
-		} `json:"product_link_list"`
+		return nil, fmt.Errorf("failed to fetch product %s: %w", id, err)
 	}
 
+	slog.Debug("Raw JSON response", "id", id, "body", string(body))
+
+	if s.unchanged[id] {
+		slog.Debug("Response unchanged, not archiving it again", "id", id)
+	} else if s.archive != nil {
+		if path, err := s.archive.save(s.locale, id, body, time.Now()); err != nil {
+			slog.Error("Failed to archive response", "id", id, "error", err)
+		} else {
+			slog.Debug("Archived response", "id", id, "path", path)
+		}
+	}
+
+	s.drift.check(id, body)
+	product, err := parseProduct(id, body)
+	if err != nil {
+		metrics.parseFailures.Inc()
+		return nil, &crawlError{"parse", err}
+	}
+	if s.enrich != nil {
+		s.enrich(product)
+	}
+	return product, nil
+}
+
+// parseProduct converts a raw /api/products/{id} response into ProductData.
+// It does no I/O, so archived responses can be reparsed offline.
+func parseProduct(id string, body []byte) (*ProductData, error) {
+	var data productResponse
+
 	if err := json.Unmarshal(body, &data); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON for %s: %v", id, err)
 	}
@@ -255,7 +577,7 @@ func (s *ScrapingSession) getProductDetails(id string) (*ProductData, error) {
 
 	product.Colors = append(product.Colors, data.AttributeList.Color)
 	for _, link := range data.ProductLinkList {
-		if link.SearchColor != data.AttributeList.Color && link.SearchColor != "" {
+		if link.SearchColor != "" && !containsString(product.Colors, link.SearchColor) {
 			product.Colors = append(product.Colors, link.SearchColor)
 		}
 	}
@@ -275,24 +597,83 @@ func (s *ScrapingSession) getProductDetails(id string) (*ProductData, error) {
 	}
 	product.Features = uniqueFeatures
 
-	fmt.Printf("  Parsed ProductData for ID %s:\n", id)
-	fmt.Printf("  ID: %s\n", product.ID)
-	fmt.Printf("  URL: %s\n", product.URL)
-	fmt.Printf("  Name: %s\n", product.Name)
-	fmt.Printf("  Price: %s\n", product.Price)
-	fmt.Printf("  Category: %s\n", product.Category)
-	fmt.Printf("  Sizes: %s\n", strings.Join(product.Sizes, ","))
-	fmt.Printf("  Colors: %s\n", strings.Join(product.Colors, ","))
-	fmt.Printf("  Availability: %s\n", product.Availability)
-	fmt.Printf("  Description: %s\n", product.Description)
-	fmt.Printf("  Images: %s\n", strings.Join(product.Images, ","))
-	fmt.Printf("  Features: %s\n", strings.Join(product.Features, ","))
-	fmt.Printf("  Sense of Fitting Rating: %s\n", product.RatingFitting)
-	fmt.Printf("  Length Appropriation Rating: %s\n", product.RatingLength)
-	fmt.Printf("  Material Quality Rating: %s\n", product.RatingQuality)
-	fmt.Printf("  Comfort Rating: %s\n", product.RatingComfort)
-	fmt.Printf("  Average Rating: %s\n", product.AverageRating)
-	fmt.Printf("  Review Count: %s\n", product.ReviewCount)
+	attrs := data.AttributeList
+	product.ModelNumber = data.ModelNumber
+	product.ProductType = data.ProductType
+	product.Subtitle = data.ProductDescription.Subtitle
+	product.Gender = attrs.Gender
+	product.Sports = attrs.Sport
+	product.ProductTypes = attrs.ProductType
+	product.CurrentPrice = data.PricingInformation.CurrentPrice
+	product.StandardPrice = data.PricingInformation.StandardPrice
+	product.StandardPriceNoVAT = data.PricingInformation.StandardPriceNoVAT
+	product.OnSale = attrs.Sale
+	product.Outlet = attrs.Outlet
+	product.Orderable = attrs.IsOrderable
+	product.PreviewEnd = attrs.PreviewTo
+	product.BadgeText = attrs.BadgeText
+	product.BadgeStyle = attrs.BadgeStyle
+	product.SearchColor = attrs.SearchColor
+	product.SubBrand = attrs.Brand
+	product.SizeChartURL = attrs.SizeChartLink
+	product.Sustainability = attrs.Sustainability
+	product.Breadcrumbs = data.BreadcrumbList
+	product.CareInstructions = data.ProductDescription.WashCareInstructions.CareInstructions
+	product.Variations = data.VariationList
+	product.NormalizedSizes = normalizeSizes(product.Sizes, isFootwear(product.Category))
+	product.NormalizedColors = normalizeColors(product.Colors)
+	product.Functions = attrs.Functions
+	product.Fit = attrs.ProductFit
+	product.Materials = attrs.BaseMaterial
+	product.USPs = data.ProductDescription.Usps
+	for _, crumb := range data.BreadcrumbList {
+		product.CategoryPath = append(product.CategoryPath, crumb.Text)
+	}
+	for _, link := range data.ProductLinkList {
+		product.ColorVariations = append(product.ColorVariations, ColorVariation{
+			ID:           link.ProductID,
+			Name:         link.Name,
+			URL:          link.URL,
+			DefaultColor: link.DefaultColor,
+			SearchColor:  link.SearchColor,
+		})
+	}
+	for _, asset := range data.ViewList {
+		product.GalleryImages = append(product.GalleryImages, asset.ImageURL)
+	}
+	product.MetaTitle = data.MetaData.PageTitle
+	product.MetaDescription = data.MetaData.Description
+	product.MetaKeywords = data.MetaData.Keywords
+	product.CanonicalURL = data.MetaData.Canonical
+	product.Extra = unmodeledFields(body)
+
+	slog.Debug("Parsed product",
+		"id", product.ID,
+		"url", product.URL,
+		"name", product.Name,
+		"price", product.Price,
+		"category", product.Category,
+		"sizes", strings.Join(product.Sizes, ","),
+		"colors", strings.Join(product.Colors, ","),
+		"availability", product.Availability,
+		"description", product.Description,
+		"images", strings.Join(product.Images, ","),
+		"features", strings.Join(product.Features, ","),
+		"rating_fitting", product.RatingFitting,
+		"rating_length", product.RatingLength,
+		"rating_quality", product.RatingQuality,
+		"rating_comfort", product.RatingComfort,
+		"average_rating", product.AverageRating,
+		"review_count", product.ReviewCount,
+		"model_number", product.ModelNumber,
+		"gender", product.Gender,
+		"standard_price", product.StandardPrice,
+		"on_sale", product.OnSale,
+		"preview_end", product.PreviewEnd,
+		"breadcrumbs", len(product.Breadcrumbs),
+		"care_instructions", len(product.CareInstructions),
+		"extra", len(product.Extra),
+	)
 
 	return product, nil
 }
@@ -306,7 +687,7 @@ func initExcel(filename string) (*excelize.File, int, error) {
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to open existing Excel file %s: %v", filename, err)
 		}
-		fmt.Printf("Opened existing Excel file: %s\n", filename)
+		slog.Info("Opened existing Excel file", "file", filename)
 	} else {
 		f = excelize.NewFile()
 		index, err := f.NewSheet(sheet)
@@ -315,30 +696,11 @@ func initExcel(filename string) (*excelize.File, int, error) {
 		}
 		f.SetActiveSheet(index)
 
-		headers := []string{
-			"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
-			"Description", "Images", "Features", "Sense of Fitting Rating",
-			"Length Appropriation Rating", "Material Quality Rating", "Comfort Rating",
-			"Average Rating", "Review Count",
-		}
-		for col, header := range headers {
-			cell := fmt.Sprintf("%s1", string(rune('A'+col)))
-			f.SetCellValue(sheet, cell, header)
-			style, err := f.NewStyle(&excelize.Style{
-				Font: &excelize.Font{Bold: true},
-			})
-			if err != nil {
-				return nil, 0, fmt.Errorf("failed to create header style: %v", err)
-			}
-			f.SetCellStyle(sheet, cell, cell, style)
+		if err := writeExcelHeader(f, sheet); err != nil {
+			return nil, 0, err
 		}
 
-		for col := 'A'; col <= 'Q'; col++ {
-			colName := string(col)
-			f.SetColWidth(sheet, colName, colName, 20)
-		}
-
-		fmt.Printf("Created new Excel file: %s\n", filename)
+		slog.Info("Created new Excel file", "file", filename)
 	}
 
 	if err := f.SaveAs(filename); err != nil {
@@ -346,13 +708,42 @@ func initExcel(filename string) (*excelize.File, int, error) {
 	}
 
 	if stat, err := os.Stat(filename); err == nil {
-		fmt.Printf("Initial Excel file size: %d bytes\n", stat.Size())
+		slog.Debug("Initial Excel file size", "file", filename, "bytes", stat.Size())
 	}
 
 	return f, f.GetActiveSheetIndex(), nil
 }
 
-func initCSV(filename string) (*os.File, *csv.Writer, error) {
+// writeExcelHeader writes the bold output header into the first row of sheet.
+func writeExcelHeader(f *excelize.File, sheet string) error {
+	style, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create header style: %v", err)
+	}
+	for col, header := range outputHeaders() {
+		cell, _ := excelize.CoordinatesToCellName(col+1, 1)
+		f.SetCellValue(sheet, cell, header)
+		f.SetCellStyle(sheet, cell, cell, style)
+	}
+
+	lastCol, _ := excelize.ColumnNumberToName(len(productColumns) + 1)
+	f.SetColWidth(sheet, "A", lastCol, 20)
+	return nil
+}
+
+func initCSV(filename string, opts CSVOptions) (*os.File, *csv.Writer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if stat, err := os.Stat(filename); err == nil && stat.Size() > 0 {
+		if err := validateCSVSchema(filename, opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open CSV file %s: %v", filename, err)
@@ -366,183 +757,66 @@ func initCSV(filename string) (*os.File, *csv.Writer, error) {
 	writer := csv.NewWriter(file)
 
 	if stat.Size() == 0 {
-		headers := []string{
-			"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
-			"Description", "Images", "Features", "Sense of Fitting Rating",
-			"",
-			"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+		if opts.BOM {
+			if _, err := file.WriteString(utf8BOM); err != nil {
+				file.Close()
+				return nil, nil, fmt.Errorf("failed to write BOM to %s: %v", filename, err)
+			}
 		}
-		if err := writer.Write(headers); err != nil {
+		if err := writer.Write(outputHeaders()); err != nil {
 			file.Close()
 			return nil, nil, fmt.Errorf("failed to write CSV headers: %v", err)
 		}
 		writer.Flush()
-		fmt.Printf("Created new CSV file with headers: %s\n", filename)
+		if err := writeCSVSchemaInfo(filename, opts); err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to write CSV schema file for %s: %v", filename, err)
+		}
+		slog.Info("Created new CSV file", "file", filename, "schema_version", csvSchemaVersion)
 	} else {
-		fmt.Printf("Found existing CSV file: %s\n", filename)
+		slog.Debug("Found existing CSV file", "file", filename)
 	}
 
-	fmt.Printf("Initial CSV file size: %d bytes\n", stat.Size())
+	slog.Debug("Initial CSV file size", "file", filename, "bytes", stat.Size())
 
 	return file, writer, nil
 }
 
-func writeProductToExcel(f *excelize.File, sheet string, row int, p *ProductData, filename string) error {
-	fmt.Printf("Writing ID %s to Excel at row %d\n", p.ID, row)
-
-	f.SetCellValue(sheet, fmt.Sprintf("A%d", row), p.ID)
-	f.SetCellValue(sheet, fmt.Sprintf("B%d", row), p.URL)
-	f.SetCellValue(sheet, fmt.Sprintf("C%d", row), p.Name)
-	f.SetCellValue(sheet, fmt.Sprintf("D%d", row), p.Price)
-	f.SetCellValue(sheet, fmt.Sprintf("E%d", row), p.Category)
-	f.SetCellValue(sheet, fmt.Sprintf("F%d", row), strings.Join(p.Sizes, ","))
-	f.SetCellValue(sheet, fmt.Sprintf("G%d", row), strings.Join(p.Colors, ","))
-	f.SetCellValue(sheet, fmt.Sprintf("H%d", row), p.Availability)
-	f.SetCellValue(sheet, fmt.Sprintf("I%d", row), p.Description)
-	f.SetCellValue(sheet, fmt.Sprintf("J%d", row), strings.Join(p.Images, ","))
-	f.SetCellValue(sheet, fmt.Sprintf("K%d", row), strings.Join(p.Features, ","))
-	f.SetCellValue(sheet, fmt.Sprintf("L%d", row), p.RatingFitting)
-	f.SetCellValue(sheet, fmt.Sprintf("M%d", row), p.RatingLength)
-	f.SetCellValue(sheet, fmt.Sprintf("N%d", row), p.RatingQuality)
-	f.SetCellValue(sheet, fmt.Sprintf("O%d", row), p.RatingComfort)
-	f.SetCellValue(sheet, fmt.Sprintf("P%d", row), p.AverageRating)
-	f.SetCellValue(sheet, fmt.Sprintf("Q%d", row), p.ReviewCount)
+func writeProductToExcel(f *excelize.File, sheet string, row int, record []string, filename string) error {
+	id := record[0]
+
+	for col, value := range record {
+		cell, _ := excelize.CoordinatesToCellName(col+1, row)
+		f.SetCellValue(sheet, cell, value)
+	}
 
 	if err := f.Save(); err != nil {
-		return fmt.Errorf("failed to save Excel file for row %d (ID %s): %v", row, p.ID, err)
+		return fmt.Errorf("failed to save Excel file for row %d (ID %s): %v", row, id, err)
 	}
 
 	if stat, err := os.Stat(filename); err == nil {
-		fmt.Printf("Excel file size after writing ID %s: %d bytes\n", p.ID, stat.Size())
+		slog.Debug("Wrote product to Excel", "id", id, "row", row, "file_bytes", stat.Size())
 	} else {
-		fmt.Printf(" Failed to get Excel file size: %v\n", err)
+		slog.Warn("Failed to get Excel file size", "file", filename, "error", err)
 	}
-
-	fmt.Printf("Successfully wrote ID %s to Excel at row %d\n", p.ID, row)
 	return nil
 }
 
-func writeProductToCSV(w *csv.Writer, p *ProductData, filename string) error {
-	fmt.Printf("Writing ID %s to CSV\n", p.ID)
-
-	record := []string{
-		p.ID,
-		p.URL,
-		p.Name,
-		p.Price,
-		p.Category,
-		strings.Join(p.Sizes, ","),
-		strings.Join(p.Colors, ","),
-		p.Availability,
-		p.Description,
-		strings.Join(p.Images, ","),
-		strings.Join(p.Features, ","),
-		p.RatingFitting,
-		p.RatingLength,
-		p.RatingQuality,
-		p.RatingComfort,
-		p.AverageRating,
-		p.ReviewCount,
-	}
+func writeProductToCSV(w *csv.Writer, record []string, filename string) error {
+	id := record[0]
 
 	if err := w.Write(record); err != nil {
-		return fmt.Errorf("failed to write CSV for ID %s: %v", p.ID, err)
+		return fmt.Errorf("failed to write CSV for ID %s: %v", id, err)
 	}
 	w.Flush()
 	if err := w.Error(); err != nil {
-		return fmt.Errorf("failed to flush CSV for ID %s: %v", p.ID, err)
+		return fmt.Errorf("failed to flush CSV for ID %s: %v", id, err)
 	}
 
 	if stat, err := os.Stat(filename); err == nil {
-		fmt.Printf("CSV file size after writing ID %s: %d bytes\n", p.ID, stat.Size())
+		slog.Debug("Wrote product to CSV", "id", id, "file_bytes", stat.Size())
 	} else {
-		fmt.Printf("Failed to get CSV file size: %v\n", err)
+		slog.Warn("Failed to get CSV file size", "file", filename, "error", err)
 	}
-
-	fmt.Printf("Successfully wrote ID %s to CSV\n", p.ID)
 	return nil
 }
-
-func getNextExcelRow(f *excelize.File, sheet string) int {
-	rows, err := f.GetRows(sheet)
-	if err != nil {
-		fmt.Printf("Failed to get rows for sheet %s, assuming row 1: %v\n", sheet, err)
-		return 1
-	}
-	return len(rows) + 1
-}
-
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	fmt.Println("Starting Adidas API crawler for 224 products...")
-
-	fmt.Println("Reading IDs from skus_from_html.txt...")
-	ids, err := readSKUs("skus_from_html.txt")
-	if err != nil {
-		log.Fatalf("Failed to read IDs: %v", err)
-	}
-	fmt.Printf("Loaded %d IDs\n", len(ids))
-
-	excelFilename := "adidas_products.xlsx"
-	f, _, err := initExcel(excelFilename)
-	if err != nil {
-		log.Fatalf("Failed to initialize Excel file: %v", err)
-	}
-	defer func() {
-		if err := f.SaveAs(excelFilename); err != nil {
-			fmt.Printf("Failed to perform final save of Excel file: %v\n", err)
-		}
-		if err := f.Close(); err != nil {
-			fmt.Printf("Failed to close Excel file: %v\n", err)
-		}
-		fmt.Printf("Closed Excel file: %s\n", excelFilename)
-		if stat, err := os.Stat(excelFilename); err == nil {
-			fmt.Printf("Final Excel file size: %d bytes\n", stat.Size())
-		}
-	}()
-
-	csvFilename := "adidas_products.csv"
-	csvFile, csvWriter, err := initCSV(csvFilename)
-	if err != nil {
-		log.Fatalf("Failed to initialize CSV file: %v", err)
-	}
-	defer func() {
-		csvWriter.Flush()
-		if err := csvWriter.Error(); err != nil {
-			fmt.Printf("Failed to flush CSV writer: %v\n", err)
-		}
-		if err := csvFile.Close(); err != nil {
-			fmt.Printf("Failed to close CSV file: %v\n", err)
-		}
-		fmt.Printf("Closed CSV file: %s\n", csvFilename)
-		if stat, err := os.Stat(csvFilename); err == nil {
-			fmt.Printf("Final CSV file size: %d bytes\n", stat.Size())
-		}
-	}()
-
-	session := NewScrapingSession()
-
-	for i, id := range ids {
-		fmt.Printf("Fetching ID %s (%d/%d)\n", id, i+1, len(ids))
-		product, err := session.getProductDetails(id)
-		if err != nil {
-			fmt.Printf("Failed to fetch ID %s: %v\n", id, err)
-			continue
-		}
-
-		row := getNextExcelRow(f, "Products")
-
-		if err := writeProductToExcel(f, "Products", row, product, excelFilename); err != nil {
-			fmt.Printf("Failed to write ID %s to Excel: %v\n", id, err)
-			continue
-		}
-
-		if err := writeProductToCSV(csvWriter, product, csvFilename); err != nil {
-			fmt.Printf("Failed to write ID %s to CSV: %v\n", id, err)
-			continue
-		}
-
-		time.Sleep(time.Duration(2+rand.Intn(3)) * time.Second)
-	}
-
-}
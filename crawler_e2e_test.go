@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// inTempDir runs the rest of the test in a fresh directory, since commands
+// write their outputs to the working directory.
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// memorySink collects the products written to it.
+type memorySink struct {
+	products map[string]*ProductData
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) WriteProduct(p *ProductData) error {
+	if s.products == nil {
+		s.products = make(map[string]*ProductData)
+	}
+	s.products[p.ID] = p
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestCrawlCompressedResponses(t *testing.T) {
+	for _, encoding := range []string{"", "gzip", "br"} {
+		t.Run("encoding="+encoding, func(t *testing.T) {
+			m := newMockAdidas(t)
+			m.encoding = encoding
+			session, _ := newMockSession(m, 5*time.Second)
+
+			sink := &memorySink{}
+			written, failed := crawlProducts(session, []string{"IA4845", "KB5435"}, []ProductSink{sink}, nil)
+			if written != 2 || len(failed) != 0 {
+				t.Fatalf("written %d, failed %v", written, failed)
+			}
+			if p := sink.products["KB5435"]; p.Price != "7370 JPY" || len(p.Sizes) != 10 {
+				t.Errorf("KB5435 = %+v", p)
+			}
+			if p := sink.products["IA4845"]; p.Name == "" || len(p.Images) == 0 {
+				t.Errorf("IA4845 = %+v", p)
+			}
+		})
+	}
+}
+
+func TestCrawlHonorsRetryAfter(t *testing.T) {
+	m := newMockAdidas(t)
+	m.fail("/api/products/IA4845", rateLimited("7"), rateLimited("7"))
+	session, sleeps := newMockSession(m, 5*time.Second)
+
+	if _, err := session.getProductDetails("IA4845"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.requestCount("/api/products/IA4845"); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+	if len(*sleeps) != 2 || (*sleeps)[0] != 7*time.Second || (*sleeps)[1] != 7*time.Second {
+		t.Errorf("sleeps = %v, want two waits of 7s from Retry-After", *sleeps)
+	}
+
+	artifacts, err := readErrorIndex(session.errors.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("recorded %d failures, want 2", len(artifacts))
+	}
+	a := artifacts[1]
+	if a.ProductID != "IA4845" || a.Status != 429 || a.Attempt != 2 || a.Header.Get("Retry-After") != "7" {
+		t.Errorf("artifact = %+v", a)
+	}
+	body, err := os.ReadFile(filepath.Join(session.errors.dir, a.BodyFile))
+	if err != nil || string(body) != "Too Many Requests" {
+		t.Errorf("body %s = %q, %v", a.BodyFile, body, err)
+	}
+}
+
+func TestCrawlRetriesBotChallenge(t *testing.T) {
+	m := newMockAdidas(t)
+	m.fail("/api/products/KB5435", m.botChallenge())
+	session, sleeps := newMockSession(m, 5*time.Second)
+
+	p, err := session.getProductDetails("KB5435")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "KB5435" || len(*sleeps) != 1 {
+		t.Errorf("product %s after %d backoffs", p.ID, len(*sleeps))
+	}
+
+	// A challenge that never clears gives up after the retry budget.
+	m.fail("/api/products/IA4845", m.botChallenge(), m.botChallenge(), m.botChallenge(), m.botChallenge(), m.botChallenge())
+	if _, err := session.getProductDetails("IA4845"); err == nil {
+		t.Error("persistent 403 did not fail the product")
+	}
+	if got := m.requestCount("/api/products/IA4845"); got != 5 {
+		t.Errorf("requests = %d, want 5", got)
+	}
+}
+
+func TestCrawlMalformedJSONFailsOnlyThatProduct(t *testing.T) {
+	m := newMockAdidas(t)
+	m.fail("/api/products/IA4845", malformedJSON())
+	session, _ := newMockSession(m, 5*time.Second)
+
+	sink := &memorySink{}
+	written, failed := crawlProducts(session, []string{"IA4845", "KB5435", "HB9386"}, []ProductSink{sink}, nil)
+	if written != 1 || sink.products["KB5435"] == nil {
+		t.Errorf("written %d: %v", written, sink.products)
+	}
+	// HB9386 has no fixture, so the mock answers 404.
+	if len(failed) != 2 || failed[0] != "IA4845" || failed[1] != "HB9386" {
+		t.Errorf("failed = %v", failed)
+	}
+}
+
+func TestCrawlRetriesSlowResponse(t *testing.T) {
+	m := newMockAdidas(t)
+	m.fail("/api/products/KB5435", slowResponse(2*time.Second))
+	session, sleeps := newMockSession(m, 200*time.Millisecond)
+
+	if _, err := session.getProductDetails("KB5435"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.requestCount("/api/products/KB5435"); got != 2 || len(*sleeps) != 1 {
+		t.Errorf("requests = %d, backoffs = %d, want 2 and 1", got, len(*sleeps))
+	}
+}
+
+func TestDiscoverFromMockCategories(t *testing.T) {
+	m := newMockAdidas(t)
+	m.encoding = "gzip"
+	session, _ := newMockSession(m, 5*time.Second)
+
+	categories := []string{m.URL() + "/メンズ-tシャツ", m.URL() + "/メンズ-ポロシャツ"}
+	skus, err := session.discoverSKUs(categories, 2, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skus) == 0 {
+		t.Fatal("no SKUs discovered")
+	}
+	seen := make(map[string]bool)
+	for _, sku := range skus {
+		if seen[sku] {
+			t.Errorf("SKU %s reported twice", sku)
+		}
+		seen[sku] = true
+	}
+	if got := m.requestCount("/メンズ-tシャツ"); got != 2 {
+		t.Errorf("category requests = %d, want 2 pages", got)
+	}
+}
+
+// TestRunCrawlAgainstMock drives the crawl command through its flags.
+func TestRunCrawlAgainstMock(t *testing.T) {
+	m := newMockAdidas(t)
+	m.encoding = "br"
+	dir := inTempDir(t)
+	if err := os.WriteFile("skus.txt", []byte("IA4845\nKB5435\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := runCrawl([]string{
+		"-base-url", m.URL(),
+		"-request-interval", "0",
+		"-request-jitter", "0",
+		"-skus", "skus.txt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "adidas_products.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][0] != "IA4845" || records[2][0] != "KB5435" {
+		t.Errorf("CSV records = %q", records)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "adidas_products.xlsx")); err != nil {
+		t.Error(err)
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(dir, "runs", "*", reportJSONFile))
+	if len(reports) != 1 {
+		t.Fatalf("run reports = %v", reports)
+	}
+	report, err := loadPreviousReport(filepath.Join(dir, "runs"), "99999999T999999Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requested != 2 || report.Succeeded != 2 || len(report.New) != 2 || report.Outputs["csv"] != "adidas_products.csv" {
+		t.Errorf("run report = %+v", report)
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// csvSchemaVersion identifies the column layout written by initCSV. Bump it,
+// and record the previous header in csvSchemaHistory, whenever the output
+// columns change.
+const csvSchemaVersion = 8
+
+// utf8BOM lets Excel detect UTF-8 when opening the CSV on Japanese locales,
+// where it otherwise assumes Shift_JIS.
+const utf8BOM = "\ufeff"
+
+// productColumn describes one output column. Exactly one of value, list or
+// structured is set; list columns are joined according to the CSV options,
+// structured columns are always encoded as JSON.
+type productColumn struct {
+	header     string
+	value      func(p *ProductData) string
+	list       func(p *ProductData) []string
+	structured func(p *ProductData) any
+}
+
+func formatPrice(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// encodeStructured encodes a structured column, leaving empty values blank.
+func encodeStructured(v any) string {
+	if rv := reflect.ValueOf(v); !rv.IsValid() || (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && rv.Len() == 0 {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+var productColumns = []productColumn{
+	{header: "ID", value: func(p *ProductData) string { return p.ID }},
+	{header: "URL", value: func(p *ProductData) string { return p.URL }},
+	{header: "Name", value: func(p *ProductData) string { return p.Name }},
+	{header: "Price", value: func(p *ProductData) string { return p.Price }},
+	{header: "Category", value: func(p *ProductData) string { return p.Category }},
+	{header: "Sizes", list: func(p *ProductData) []string { return p.Sizes }},
+	{header: "Colors", list: func(p *ProductData) []string { return p.Colors }},
+	{header: "Availability", value: func(p *ProductData) string { return p.Availability }},
+	{header: "Description", value: func(p *ProductData) string { return p.Description }},
+	{header: "Images", list: func(p *ProductData) []string { return p.Images }},
+	{header: "Features", list: func(p *ProductData) []string { return p.Features }},
+	{header: "Sense of Fitting Rating", value: func(p *ProductData) string { return p.RatingFitting }},
+	{header: "Length Appropriation Rating", value: func(p *ProductData) string { return p.RatingLength }},
+	{header: "Material Quality Rating", value: func(p *ProductData) string { return p.RatingQuality }},
+	{header: "Comfort Rating", value: func(p *ProductData) string { return p.RatingComfort }},
+	{header: "Average Rating", value: func(p *ProductData) string { return p.AverageRating }},
+	{header: "Review Count", value: func(p *ProductData) string { return p.ReviewCount }},
+	{header: "Model Number", value: func(p *ProductData) string { return p.ModelNumber }},
+	{header: "Product Type", value: func(p *ProductData) string { return p.ProductType }},
+	{header: "Sub-Brand", value: func(p *ProductData) string { return p.SubBrand }},
+	{header: "Subtitle", value: func(p *ProductData) string { return p.Subtitle }},
+	{header: "Gender", value: func(p *ProductData) string { return p.Gender }},
+	{header: "Sports", list: func(p *ProductData) []string { return p.Sports }},
+	{header: "Product Types", list: func(p *ProductData) []string { return p.ProductTypes }},
+	{header: "Current Price", value: func(p *ProductData) string { return formatPrice(p.CurrentPrice) }},
+	{header: "Standard Price", value: func(p *ProductData) string { return formatPrice(p.StandardPrice) }},
+	{header: "Standard Price Excl. Tax", value: func(p *ProductData) string { return formatPrice(p.StandardPriceNoVAT) }},
+	{header: "On Sale", value: func(p *ProductData) string { return strconv.FormatBool(p.OnSale) }},
+	{header: "Outlet", value: func(p *ProductData) string { return strconv.FormatBool(p.Outlet) }},
+	{header: "Orderable", value: func(p *ProductData) string { return strconv.FormatBool(p.Orderable) }},
+	{header: "Preview End", value: func(p *ProductData) string { return p.PreviewEnd }},
+	{header: "Badge", value: func(p *ProductData) string { return p.BadgeText }},
+	{header: "Badge Style", value: func(p *ProductData) string { return p.BadgeStyle }},
+	{header: "Search Color", value: func(p *ProductData) string { return p.SearchColor }},
+	{header: "Size Chart URL", value: func(p *ProductData) string { return p.SizeChartURL }},
+	{header: "Sustainability", list: func(p *ProductData) []string { return p.Sustainability }},
+	{header: "Breadcrumbs", structured: func(p *ProductData) any { return p.Breadcrumbs }},
+	{header: "Care Instructions", structured: func(p *ProductData) any { return p.CareInstructions }},
+	{header: "Variations", structured: func(p *ProductData) any { return p.Variations }},
+	{header: "Normalized Sizes", structured: func(p *ProductData) any { return p.NormalizedSizes }},
+	{header: "Normalized Colors", structured: func(p *ProductData) any { return p.NormalizedColors }},
+	{header: "Functions", list: func(p *ProductData) []string { return p.Functions }},
+	{header: "Fit", list: func(p *ProductData) []string { return p.Fit }},
+	{header: "Materials", list: func(p *ProductData) []string { return p.Materials }},
+	{header: "USPs", list: func(p *ProductData) []string { return p.USPs }},
+	{header: "Material Content", structured: func(p *ProductData) any { return p.MaterialContent }},
+	{header: "Technologies", list: func(p *ProductData) []string { return p.Technologies }},
+	{header: "Category Path", list: func(p *ProductData) []string { return p.CategoryPath }},
+	{header: "Color Variations", structured: func(p *ProductData) any { return p.ColorVariations }},
+	{header: "Gallery Images", list: func(p *ProductData) []string { return p.GalleryImages }},
+	{header: "Meta Title", value: func(p *ProductData) string { return p.MetaTitle }},
+	{header: "Meta Description", value: func(p *ProductData) string { return p.MetaDescription }},
+	{header: "Meta Keywords", value: func(p *ProductData) string { return p.MetaKeywords }},
+	{header: "Canonical URL", value: func(p *ProductData) string { return p.CanonicalURL }},
+	{header: "Extra", structured: func(p *ProductData) any { return p.Extra }},
+}
+
+// csvSchemaHistory holds the header of every earlier schema version so files
+// written by older crawlers can be upgraded. Version 1 left the Length
+// Appropriation Rating column unnamed and joined lists with commas; version 2
+// had no Version column; version 3 ended at Review Count; version 4 had no
+// Normalized Sizes, version 5 no Normalized Colors, version 6 ended the
+// product columns there and version 7 had no Category Path.
+var csvSchemaHistory = map[int][]string{
+	1: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+	},
+	2: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"Length Appropriation Rating",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+	},
+	3: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"Length Appropriation Rating",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+		"Version",
+	},
+	4: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"Length Appropriation Rating",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+		"Model Number", "Product Type", "Sub-Brand", "Subtitle", "Gender", "Sports",
+		"Product Types", "Current Price", "Standard Price", "Standard Price Excl. Tax",
+		"On Sale", "Outlet", "Orderable", "Preview End", "Badge", "Badge Style",
+		"Search Color", "Size Chart URL", "Sustainability", "Breadcrumbs",
+		"Care Instructions", "Variations", "Color Variations", "Gallery Images",
+		"Meta Title", "Meta Description", "Meta Keywords", "Canonical URL", "Extra",
+		"Version",
+	},
+	5: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"Length Appropriation Rating",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+		"Model Number", "Product Type", "Sub-Brand", "Subtitle", "Gender", "Sports",
+		"Product Types", "Current Price", "Standard Price", "Standard Price Excl. Tax",
+		"On Sale", "Outlet", "Orderable", "Preview End", "Badge", "Badge Style",
+		"Search Color", "Size Chart URL", "Sustainability", "Breadcrumbs",
+		"Care Instructions", "Variations", "Normalized Sizes", "Color Variations", "Gallery Images",
+		"Meta Title", "Meta Description", "Meta Keywords", "Canonical URL", "Extra",
+		"Version",
+	},
+	6: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"Length Appropriation Rating",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+		"Model Number", "Product Type", "Sub-Brand", "Subtitle", "Gender", "Sports",
+		"Product Types", "Current Price", "Standard Price", "Standard Price Excl. Tax",
+		"On Sale", "Outlet", "Orderable", "Preview End", "Badge", "Badge Style",
+		"Search Color", "Size Chart URL", "Sustainability", "Breadcrumbs",
+		"Care Instructions", "Variations", "Normalized Sizes", "Normalized Colors",
+		"Color Variations", "Gallery Images",
+		"Meta Title", "Meta Description", "Meta Keywords", "Canonical URL", "Extra",
+		"Version",
+	},
+	7: {
+		"ID", "URL", "Name", "Price", "Category", "Sizes", "Colors", "Availability",
+		"Description", "Images", "Features", "Sense of Fitting Rating",
+		"Length Appropriation Rating",
+		"Material Quality Rating", "Comfort Rating", "Average Rating", "Review Count",
+		"Model Number", "Product Type", "Sub-Brand", "Subtitle", "Gender", "Sports",
+		"Product Types", "Current Price", "Standard Price", "Standard Price Excl. Tax",
+		"On Sale", "Outlet", "Orderable", "Preview End", "Badge", "Badge Style",
+		"Search Color", "Size Chart URL", "Sustainability", "Breadcrumbs",
+		"Care Instructions", "Variations", "Normalized Sizes", "Normalized Colors",
+		"Functions", "Fit", "Materials", "USPs", "Material Content", "Technologies",
+		"Color Variations", "Gallery Images",
+		"Meta Title", "Meta Description", "Meta Keywords", "Canonical URL", "Extra",
+		"Version",
+	},
+}
+
+func productHeaders() []string {
+	headers := make([]string, len(productColumns))
+	for i, col := range productColumns {
+		headers[i] = col.header
+	}
+	return headers
+}
+
+// CSVOptions controls how list fields are encoded in the CSV output.
+type CSVOptions struct {
+	ListDelimiter string // joins list columns when JSONLists is false
+	JSONLists     bool   // encode list columns as JSON arrays
+	BOM           bool   // prefix newly created files with a UTF-8 BOM
+}
+
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{ListDelimiter: "|"}
+}
+
+func (o CSVOptions) validate() error {
+	if o.JSONLists {
+		return nil
+	}
+	if o.ListDelimiter == "" {
+		return fmt.Errorf("CSV list delimiter must not be empty")
+	}
+	if o.ListDelimiter == "," {
+		return fmt.Errorf("CSV list delimiter must differ from the field separator; use JSON lists instead")
+	}
+	return nil
+}
+
+func (o CSVOptions) encodeList(values []string) string {
+	if o.JSONLists {
+		if values == nil {
+			values = []string{}
+		}
+		data, _ := json.Marshal(values)
+		return string(data)
+	}
+	return strings.Join(values, o.ListDelimiter)
+}
+
+func (o CSVOptions) decodeList(field string) ([]string, error) {
+	if field == "" {
+		return nil, nil
+	}
+	if o.JSONLists {
+		var values []string
+		if err := json.Unmarshal([]byte(field), &values); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON list %q: %v", field, err)
+		}
+		return values, nil
+	}
+	return strings.Split(field, o.ListDelimiter), nil
+}
+
+func productRecord(p *ProductData, opts CSVOptions) []string {
+	record := make([]string, len(productColumns))
+	for i, col := range productColumns {
+		switch {
+		case col.list != nil:
+			record[i] = opts.encodeList(col.list(p))
+		case col.structured != nil:
+			record[i] = encodeStructured(col.structured(p))
+		default:
+			record[i] = col.value(p)
+		}
+	}
+	return record
+}
+
+// csvSchemaInfo is stored next to the CSV file so later runs can tell how its
+// rows were encoded before appending to it.
+type csvSchemaInfo struct {
+	Version       int    `json:"version"`
+	ListEncoding  string `json:"list_encoding"`
+	ListDelimiter string `json:"list_delimiter,omitempty"`
+	BOM           bool   `json:"bom"`
+}
+
+func csvSchemaFilename(filename string) string {
+	return filename + ".schema.json"
+}
+
+func newCSVSchemaInfo(opts CSVOptions) csvSchemaInfo {
+	info := csvSchemaInfo{Version: csvSchemaVersion, ListEncoding: "delimited", BOM: opts.BOM}
+	if opts.JSONLists {
+		info.ListEncoding = "json"
+	} else {
+		info.ListDelimiter = opts.ListDelimiter
+	}
+	return info
+}
+
+func (info csvSchemaInfo) options() CSVOptions {
+	return CSVOptions{
+		ListDelimiter: info.ListDelimiter,
+		JSONLists:     info.ListEncoding == "json",
+		BOM:           info.BOM,
+	}
+}
+
+func sameListEncoding(a, b CSVOptions) bool {
+	if a.JSONLists || b.JSONLists {
+		return a.JSONLists == b.JSONLists
+	}
+	return a.ListDelimiter == b.ListDelimiter
+}
+
+func writeCSVSchemaInfo(filename string, opts CSVOptions) error {
+	data, err := json.MarshalIndent(newCSVSchemaInfo(opts), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(csvSchemaFilename(filename), append(data, '\n'), 0644)
+}
+
+func readCSVSchemaInfo(filename string) (*csvSchemaInfo, error) {
+	data, err := os.ReadFile(csvSchemaFilename(filename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info csvSchemaInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", csvSchemaFilename(filename), err)
+	}
+	return &info, nil
+}
+
+// readCSVHeader returns the first record of an existing CSV file with any
+// UTF-8 BOM removed.
+func readCSVHeader(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header, err := csv.NewReader(file).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	}
+	return header, nil
+}
+
+func equalHeaders(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func detectCSVSchemaVersion(header []string) int {
+	if equalHeaders(header, outputHeaders()) {
+		return csvSchemaVersion
+	}
+	for version, old := range csvSchemaHistory {
+		if equalHeaders(header, old) {
+			return version
+		}
+	}
+	return 0
+}
+
+// validateCSVSchema checks that rows written with opts can be appended to the
+// existing file without mixing layouts or list encodings.
+func validateCSVSchema(filename string, opts CSVOptions) error {
+	header, err := readCSVHeader(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read header of %s: %v", filename, err)
+	}
+	if version := detectCSVSchemaVersion(header); version != csvSchemaVersion {
+		return fmt.Errorf("CSV file %s has header %q, expected schema v%d", filename, header, csvSchemaVersion)
+	}
+
+	info, err := readCSVSchemaInfo(filename)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		slog.Info("No schema file found, assuming current list encoding", "file", filename)
+		return nil
+	}
+	if info.Version != csvSchemaVersion || !sameListEncoding(info.options(), opts) {
+		want := newCSVSchemaInfo(opts)
+		return fmt.Errorf("CSV file %s was written with schema v%d (%s lists, delimiter %q) but current options use v%d (%s lists, delimiter %q)",
+			filename, info.Version, info.ListEncoding, info.ListDelimiter, want.Version, want.ListEncoding, want.ListDelimiter)
+	}
+	return nil
+}
+
+// loadCSVTable reads the rows of an existing CSV output, converting earlier
+// schema versions and list encodings to the current ones. upgrade reports
+// whether the file has to be rewritten before new rows can be appended.
+func loadCSVTable(filename string, opts CSVOptions) (table *productTable, upgrade bool, err error) {
+	table = newProductTable()
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return table, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open CSV file %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read CSV file %s: %v", filename, err)
+	}
+	if len(records) == 0 {
+		return table, false, nil
+	}
+
+	header := records[0]
+	header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	version := detectCSVSchemaVersion(header)
+	if version == 0 {
+		return nil, false, fmt.Errorf("CSV file %s has an unrecognized header: %q", filename, header)
+	}
+
+	fileOpts := opts
+	info, err := readCSVSchemaInfo(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case version == 1:
+		fileOpts = CSVOptions{ListDelimiter: ","}
+	case info != nil:
+		fileOpts = info.options()
+	default:
+		slog.Info("No schema file found, assuming current list encoding", "file", filename)
+	}
+	reencode := !sameListEncoding(fileOpts, opts)
+	upgrade = version != csvSchemaVersion || reencode
+
+	index := headerIndex(header, version)
+
+	for line, record := range records[1:] {
+		row := make([]string, len(productColumns)+1)
+		for i, col := range productColumns {
+			pos, ok := index[col.header]
+			if !ok || pos >= len(record) {
+				continue
+			}
+			field := record[pos]
+			if col.list != nil && reencode {
+				values, err := fileOpts.decodeList(field)
+				if err != nil {
+					return nil, false, fmt.Errorf("%s line %d: %v", filename, line+2, err)
+				}
+				field = opts.encodeList(values)
+			}
+			row[i] = field
+		}
+		row[len(productColumns)] = "1"
+		if pos, ok := index[versionHeader]; ok && pos < len(record) && record[pos] != "" {
+			row[len(productColumns)] = record[pos]
+		}
+		table.load(row)
+	}
+
+	if upgrade {
+		slog.Info("Upgrading CSV file schema", "file", filename, "from_version", version, "to_version", csvSchemaVersion)
+	}
+	return table, upgrade, nil
+}
+
+// headerIndex maps column names to their position in a header of the given
+// schema version. Version 1 differs from version 2 only in the blank header,
+// so its columns are mapped by position using the version 2 names.
+func headerIndex(header []string, version int) map[string]int {
+	names := header
+	if version == 1 {
+		names = csvSchemaHistory[2]
+	}
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+	return index
+}
+
+// rewriteCSV atomically replaces filename with the rows in table, written
+// with the current header and list encoding.
+func rewriteCSV(filename string, table *productTable, opts CSVOptions) error {
+	tmp := filename + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", tmp, err)
+	}
+	if opts.BOM {
+		if _, err := file.WriteString(utf8BOM); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write BOM to %s: %v", tmp, err)
+		}
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(outputHeaders())
+	writer.WriteAll(table.rows)
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %v", tmp, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", filename, err)
+	}
+	return writeCSVSchemaInfo(filename, opts)
+}
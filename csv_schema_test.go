@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLegacyCSV writes a file with header and one row holding the given
+// values by column name.
+func writeLegacyCSV(t *testing.T, filename string, header []string, values map[string]string) {
+	t.Helper()
+	record := make([]string, len(header))
+	for i, name := range header {
+		record[i] = values[name]
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	w.Write(record)
+	w.Flush()
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCSVTableUpgradesEveryVersion(t *testing.T) {
+	opts := DefaultCSVOptions()
+	sizesCol, nameCol := 5, 2
+	for version, header := range csvSchemaHistory {
+		filename := filepath.Join(t.TempDir(), "products.csv")
+		values := map[string]string{"ID": "IA4845", "Name": "Tee", "Sizes": "J/S|J/M", "Version": "2"}
+		if version == 1 {
+			// Version 1 joined lists with commas.
+			values["Sizes"] = "J/S,J/M"
+		}
+		writeLegacyCSV(t, filename, header, values)
+
+		table, upgrade, err := loadCSVTable(filename, opts)
+		if err != nil {
+			t.Errorf("v%d: %v", version, err)
+			continue
+		}
+		if !upgrade {
+			t.Errorf("v%d: file not flagged for upgrade", version)
+		}
+		row := table.rows[table.latest["IA4845"]]
+		if len(row) != len(outputHeaders()) || row[nameCol] != "Tee" || row[sizesCol] != "J/S|J/M" {
+			t.Errorf("v%d: row = %q", version, row)
+		}
+		wantVersion := "2"
+		if !containsString(header, versionHeader) {
+			wantVersion = "1"
+		}
+		if got := row[len(row)-1]; got != wantVersion {
+			t.Errorf("v%d: row version = %s, want %s", version, got, wantVersion)
+		}
+
+		if err := rewriteCSV(filename, table, opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := validateCSVSchema(filename, opts); err != nil {
+			t.Errorf("v%d: upgraded file does not validate: %v", version, err)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "products.csv")
+	writeLegacyCSV(t, filename, outputHeaders(), map[string]string{"ID": "IA4845"})
+	if _, upgrade, err := loadCSVTable(filename, opts); err != nil || upgrade {
+		t.Errorf("current version: upgrade = %v, err = %v", upgrade, err)
+	}
+}
+
+func TestCSVSchemaRejectsUnknownHeaders(t *testing.T) {
+	opts := DefaultCSVOptions()
+	newer := append(outputHeaders(), "Future Column")
+	for name, header := range map[string][]string{
+		"unknown": {"ID", "Title", "Price"},
+		"newer":   newer,
+	} {
+		filename := filepath.Join(t.TempDir(), "products.csv")
+		writeLegacyCSV(t, filename, header, map[string]string{"ID": "IA4845"})
+		if _, _, err := loadCSVTable(filename, opts); err == nil {
+			t.Errorf("%s header: loadCSVTable accepted %q", name, header)
+		}
+		if err := validateCSVSchema(filename, opts); err == nil {
+			t.Errorf("%s header: validateCSVSchema accepted %q", name, header)
+		}
+	}
+
+	// A schema file from a newer crawler is rejected even when the header
+	// matches.
+	filename := filepath.Join(t.TempDir(), "products.csv")
+	writeLegacyCSV(t, filename, outputHeaders(), map[string]string{"ID": "IA4845"})
+	info := `{"version": 99, "list_encoding": "delimited", "list_delimiter": "|"}`
+	if err := os.WriteFile(csvSchemaFilename(filename), []byte(info), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCSVSchema(filename, opts); err == nil {
+		t.Error("validateCSVSchema accepted a newer schema file")
+	}
+}
+
+func TestCSVRoundTripWithBOM(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "products.csv")
+	opts := DefaultCSVOptions()
+	opts.BOM = true
+
+	for i := 0; i < 2; i++ {
+		sink, err := newCSVSink(filename, opts, ModeUpsert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &ProductData{ID: "IA4845", Name: "Tee", Sizes: []string{"J/S", "J/M"}, Price: []string{"4400 JPY", "3960 JPY"}[i]}
+		if err := sink.WriteProduct(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), utf8BOM+"ID,") || strings.Count(string(data), utf8BOM) != 1 {
+		t.Errorf("file does not start with exactly one BOM: %q", data[:min(len(data), 20)])
+	}
+	if err := validateCSVSchema(filename, opts); err != nil {
+		t.Fatal(err)
+	}
+	table, upgrade, err := loadCSVTable(filename, opts)
+	if err != nil || upgrade {
+		t.Fatalf("upgrade = %v, err = %v", upgrade, err)
+	}
+	if len(table.rows) != 1 {
+		t.Fatalf("rows = %q", table.rows)
+	}
+	if row := table.rows[0]; row[0] != "IA4845" || row[3] != "3960 JPY" || row[5] != "J/S|J/M" {
+		t.Errorf("row = %q", row)
+	}
+}
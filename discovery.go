@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+)
+
+// categoryPageSize is the number of products per category listing page; later
+// pages are requested with ?start=48, ?start=96 and so on.
+const categoryPageSize = 48
+
+// defaultCategoryURLs are the men's T-shirt, polo shirt and jersey listings
+// the SKU list was originally built from.
+var defaultCategoryURLs = []string{
+	"https://www.adidas.jp/メンズ-tシャツ",
+	"https://www.adidas.jp/メンズ-ポロシャツ",
+	"https://www.adidas.jp/メンズ-ジャージ",
+}
+
+func categoryPageURL(categoryURL string, page int) (string, error) {
+	u, err := url.Parse(categoryURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid category URL %s: %v", categoryURL, err)
+	}
+	if page > 0 {
+		q := u.Query()
+		q.Set("start", fmt.Sprint(page*categoryPageSize))
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// discoverSKUs fetches the first pages of each category listing and returns
+// the product IDs found that are not already in existing.
+func (s *ScrapingSession) discoverSKUs(categoryURLs []string, pages int, existing map[string]bool) ([]string, error) {
+	seen := make(map[string]bool)
+	for sku := range existing {
+		seen[sku] = true
+	}
+
+	var skus []string
+	for _, categoryURL := range categoryURLs {
+		for page := 0; page < pages; page++ {
+			pageURL, err := categoryPageURL(categoryURL, page)
+			if err != nil {
+				return skus, err
+			}
+			slog.Info("Scraping category page", "url", pageURL)
+			body, err := s.fetch(pageURL, 3, requestOptions{dest: destDocument})
+			if err != nil {
+				slog.Error("Failed to fetch category page", "url", pageURL, "error", err)
+				continue
+			}
+			found := extractSKUs(string(body), seen)
+			for _, sku := range found {
+				seen[sku] = true
+			}
+			skus = append(skus, found...)
+			slog.Info("Found new SKUs on page", "url", pageURL, "skus", len(found))
+		}
+	}
+	return skus, nil
+}
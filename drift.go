@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JSON value kinds checked by the product schema.
+const (
+	kindString = "string"
+	kindNumber = "number"
+	kindBool   = "bool"
+	kindArray  = "array"
+	kindObject = "object"
+	kindNull   = "null"
+)
+
+// schemaField is a field parseProduct relies on. Paths are dot-separated;
+// "[]" applies the rest of the path to every element of an array.
+type schemaField struct {
+	path     string
+	kind     string
+	required bool // missing counts as drift
+	nullable bool // null does not count as drift
+}
+
+// productSchema lists the fields of /api/products/{id} responses the parsed
+// product is built from.
+var productSchema = []schemaField{
+	{path: "id", kind: kindString, required: true},
+	{path: "name", kind: kindString, required: true},
+	{path: "pricing_information", kind: kindObject, required: true},
+	{path: "pricing_information.currentPrice", kind: kindNumber, required: true},
+	{path: "attribute_list", kind: kindObject, required: true},
+	{path: "attribute_list.category", kind: kindString, required: true},
+	{path: "attribute_list.color", kind: kindString, required: true},
+	{path: "attribute_list.is_orderable", kind: kindBool, required: true},
+	{path: "attribute_list.functions", kind: kindArray},
+	{path: "attribute_list.productfit", kind: kindArray},
+	{path: "attribute_list.base_material", kind: kindArray},
+	{path: "product_description", kind: kindObject, required: true},
+	{path: "product_description.text", kind: kindString, required: true},
+	{path: "product_description.usps", kind: kindArray},
+	{path: "product_listing_assets", kind: kindArray, required: true},
+	{path: "product_listing_assets[].image_url", kind: kindString, required: true},
+	{path: "variation_list", kind: kindArray, required: true},
+	{path: "variation_list[].size", kind: kindString, required: true},
+	{path: "product_link_list", kind: kindArray},
+	{path: "product_link_list[].search_color", kind: kindString},
+}
+
+// Drift problems.
+const (
+	driftMissing = "missing"
+	driftNull    = "null"
+	driftType    = "type"
+)
+
+// driftIssue is one field of a response that does not match productSchema.
+type driftIssue struct {
+	Field   string
+	Problem string // missing, null or type
+	Got     string // the kind found, for type changes
+}
+
+// validateProductJSON checks a product response against productSchema. Each
+// field is reported at most once per response, even when several array
+// elements fail. Invalid JSON is an error rather than drift.
+func validateProductJSON(body []byte) ([]driftIssue, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to decode product JSON: %v", err)
+	}
+	if _, ok := root.(map[string]any); !ok {
+		return []driftIssue{{Field: "$", Problem: driftType, Got: jsonKind(root)}}, nil
+	}
+
+	var issues []driftIssue
+	for _, f := range productSchema {
+		found := make(map[driftIssue]bool)
+		checkField(f, root, strings.Split(strings.ReplaceAll(f.path, "[]", ".[]"), "."), found)
+		for issue := range found {
+			issues = append(issues, issue)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Field != issues[j].Field {
+			return issues[i].Field < issues[j].Field
+		}
+		return issues[i].Problem < issues[j].Problem
+	})
+	return issues, nil
+}
+
+// checkField follows segs from v and records the problems of field f.
+// Parents that are missing or of the wrong kind are reported by their own
+// schema entry, so checkField stops there.
+func checkField(f schemaField, v any, segs []string, found map[driftIssue]bool) {
+	if len(segs) == 0 {
+		switch got := jsonKind(v); {
+		case got == kindNull && !f.nullable:
+			found[driftIssue{Field: f.path, Problem: driftNull}] = true
+		case got != kindNull && got != f.kind:
+			found[driftIssue{Field: f.path, Problem: driftType, Got: got}] = true
+		}
+		return
+	}
+	if segs[0] == "[]" {
+		elems, _ := v.([]any)
+		for _, elem := range elems {
+			checkField(f, elem, segs[1:], found)
+		}
+		return
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	child, ok := obj[segs[0]]
+	if !ok {
+		if len(segs) == 1 && f.required {
+			found[driftIssue{Field: f.path, Problem: driftMissing}] = true
+		}
+		return
+	}
+	checkField(f, child, segs[1:], found)
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return kindNull
+	case string:
+		return kindString
+	case json.Number, float64:
+		return kindNumber
+	case bool:
+		return kindBool
+	case []any:
+		return kindArray
+	case map[string]any:
+		return kindObject
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// DriftOptions sets when schema drift is reported. Rates are the share of
+// checked responses with a given problem on a given field; 0 disables the
+// threshold.
+type DriftOptions struct {
+	WarnRate     float64 // logged as a warning at the end of the run
+	FailRate     float64 // stops the crawl
+	MinResponses int     // responses checked before FailRate applies
+}
+
+// driftStat aggregates one problem on one field over a run.
+type driftStat struct {
+	Field    string   `json:"field"`
+	Problem  string   `json:"problem"`
+	Got      []string `json:"got,omitempty"` // kinds seen for type changes
+	Count    int      `json:"count"`
+	Rate     float64  `json:"rate"`
+	Examples []string `json:"examples"` // first product IDs with the problem
+}
+
+const maxDriftExamples = 5
+
+// driftMonitor collects the drift of the product responses of a run. A nil
+// monitor checks nothing.
+type driftMonitor struct {
+	mu        sync.Mutex
+	opts      DriftOptions
+	responses int
+	stats     map[string]*driftStat // by field and problem
+}
+
+func newDriftMonitor(opts DriftOptions) *driftMonitor {
+	return &driftMonitor{opts: opts, stats: make(map[string]*driftStat)}
+}
+
+// check validates a product response and records its drift. Responses that
+// are not JSON at all are left to the parser.
+func (m *driftMonitor) check(id string, body []byte) {
+	if m == nil {
+		return
+	}
+	issues, err := validateProductJSON(body)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses++
+	for _, issue := range issues {
+		key := issue.Field + " " + issue.Problem
+		stat, seen := m.stats[key]
+		if !seen {
+			stat = &driftStat{Field: issue.Field, Problem: issue.Problem}
+			m.stats[key] = stat
+			slog.Warn("Product JSON does not match the expected schema", "id", id,
+				"field", issue.Field, "problem", issue.Problem, "got", issue.Got)
+		}
+		stat.Count++
+		if issue.Got != "" && !containsString(stat.Got, issue.Got) {
+			stat.Got = append(stat.Got, issue.Got)
+		}
+		if len(stat.Examples) < maxDriftExamples {
+			stat.Examples = append(stat.Examples, id)
+		}
+		metrics.schemaDrift.WithLabelValues(issue.Field, issue.Problem).Inc()
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// summary returns the drift seen so far, most frequent first.
+func (m *driftMonitor) summary() []driftStat {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stats []driftStat
+	for _, s := range m.stats {
+		stat := *s
+		stat.Rate = float64(stat.Count) / float64(m.responses)
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Field+stats[i].Problem < stats[j].Field+stats[j].Problem
+	})
+	return stats
+}
+
+// exceeded returns an error once a problem reached FailRate.
+func (m *driftMonitor) exceeded() error {
+	if m == nil || m.opts.FailRate <= 0 {
+		return nil
+	}
+	m.mu.Lock()
+	responses := m.responses
+	m.mu.Unlock()
+	if responses < m.opts.MinResponses {
+		return nil
+	}
+	for _, s := range m.summary() {
+		if s.Rate >= m.opts.FailRate {
+			return fmt.Errorf("schema drift: %s is %s in %d of %d product responses (fail rate %.0f%%)",
+				s.Field, s.Problem, s.Count, responses, m.opts.FailRate*100)
+		}
+	}
+	return nil
+}
+
+// warn logs the problems that reached WarnRate.
+func (m *driftMonitor) warn() {
+	if m == nil || m.opts.WarnRate <= 0 {
+		return
+	}
+	for _, s := range m.summary() {
+		if s.Rate >= m.opts.WarnRate {
+			slog.Warn("Schema drift", "field", s.Field, "problem", s.Problem, "got", strings.Join(s.Got, ","),
+				"responses", s.Count, "rate", fmt.Sprintf("%.1f%%", s.Rate*100), "examples", strings.Join(s.Examples, ","))
+		}
+	}
+}
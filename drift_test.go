@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateProductJSONFixtures(t *testing.T) {
+	for _, id := range []string{"IA4845", "KB5435"} {
+		body, err := os.ReadFile(filepath.Join("testdata", "products", id+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		issues, err := validateProductJSON(body)
+		if err != nil || len(issues) != 0 {
+			t.Errorf("%s: issues %+v, %v", id, issues, err)
+		}
+	}
+}
+
+// driftedProduct returns the IA4845 fixture after edit changed it.
+func driftedProduct(t *testing.T, edit func(map[string]any)) []byte {
+	body, err := os.ReadFile(filepath.Join("testdata", "products", "IA4845.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var product map[string]any
+	if err := json.Unmarshal(body, &product); err != nil {
+		t.Fatal(err)
+	}
+	edit(product)
+	drifted, _ := json.Marshal(product)
+	return drifted
+}
+
+func TestValidateProductJSONDrift(t *testing.T) {
+	body := driftedProduct(t, func(p map[string]any) {
+		p["pricing"] = p["pricing_information"]
+		delete(p, "pricing_information")
+		p["name"] = nil
+		p["attribute_list"].(map[string]any)["is_orderable"] = "true"
+		variations := p["variation_list"].([]any)
+		delete(variations[0].(map[string]any), "size")
+		delete(variations[1].(map[string]any), "size")
+	})
+	issues, err := validateProductJSON(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []driftIssue{
+		{Field: "attribute_list.is_orderable", Problem: driftType, Got: kindString},
+		{Field: "name", Problem: driftNull},
+		{Field: "pricing_information", Problem: driftMissing},
+		{Field: "variation_list[].size", Problem: driftMissing},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %+v", issues)
+	}
+
+	if _, err := validateProductJSON([]byte(`{"id":`)); err == nil {
+		t.Error("truncated JSON reported as drift")
+	}
+}
+
+// TestSchemaDriftStopsCrawl serves products whose price field was renamed
+// and checks that the crawl stops once the fail rate is reached.
+func TestSchemaDriftStopsCrawl(t *testing.T) {
+	m := newMockAdidas(t)
+	renamed := driftedProduct(t, func(p map[string]any) {
+		p["price_information"] = p["pricing_information"]
+		delete(p, "pricing_information")
+	})
+	m.fail("/api/products/IA4845", mockFailure{status: 200, body: renamed})
+	session, _ := newMockSession(m, 5*time.Second)
+	session.drift = newDriftMonitor(DriftOptions{WarnRate: 0.1, FailRate: 0.5, MinResponses: 2})
+
+	report := newRunReport("20250623T090000Z", time.Now())
+	_, failed := crawlProducts(session, []string{"KB5435", "IA4845", "KB5441", "HB9386"}, []ProductSink{&memorySink{}}, report)
+	if len(failed) != 0 || len(report.Failures) != 0 || !reflect.DeepEqual(report.NotAttempted, []string{"KB5441", "HB9386"}) {
+		t.Fatalf("failed %v, failures %v, not attempted %v", failed, report.Failures, report.NotAttempted)
+	}
+	if n := m.requestCount("/api/products/IA4845"); n != 1 {
+		t.Errorf("IA4845 fetched %d times after the crawl stopped", n)
+	}
+	if err := session.drift.exceeded(); err == nil || !strings.Contains(err.Error(), "pricing_information is missing in 1 of 2") {
+		t.Errorf("exceeded() = %v", err)
+	}
+
+	report.finish(session, nil, nil, time.Now())
+	if len(report.SchemaDrift) != 1 || report.SchemaDrift[0].Examples[0] != "IA4845" || report.SchemaDrift[0].Rate != 0.5 {
+		t.Errorf("report drift = %+v", report.SchemaDrift)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"log/slog"
 	"os"
 	"regexp"
 	"strings"
@@ -38,42 +39,48 @@ func extractSKUsFromHTML(filePath string, existingSKUs map[string]bool) ([]strin
 		return nil, fmt.Errorf("failed to read file %s: %v", filePath, err)
 	}
 
-	bodyStr := string(htmlContent)
+	skus := extractSKUs(string(htmlContent), existingSKUs)
+	if len(skus) == 0 {
+		slog.Warn("No SKUs extracted", "file", filePath)
+	}
+	return skus, nil
+}
+
+// extractSKUs returns the product IDs linked or mentioned in a category page,
+// in order of appearance, skipping those already in existingSKUs.
+func extractSKUs(bodyStr string, existingSKUs map[string]bool) []string {
 	var skus []string
 	skuMap := make(map[string]bool)
 
 	linkRe := regexp.MustCompile(`href="[^"]*/products/([A-Z]{2}[0-9]{4})[^"]*"`)
 	linkMatches := linkRe.FindAllStringSubmatch(bodyStr, -1)
-	fmt.Printf("Found %d href matches for /products/[SKU]\n", len(linkMatches))
+	slog.Debug("Found href matches for /products/[SKU]", "count", len(linkMatches))
 	for _, match := range linkMatches {
 		if len(match) > 1 {
 			sku := match[1]
 			if !skuMap[sku] && !existingSKUs[sku] {
 				skus = append(skus, sku)
 				skuMap[sku] = true
-				fmt.Printf("Extracted SKU from href: %s\n", sku)
+				slog.Debug("Extracted SKU from href", "sku", sku)
 			}
 		}
 	}
 
 	textRe := regexp.MustCompile(`\b([A-Z]{2}[0-9]{4})\b`)
 	textMatches := textRe.FindAllStringSubmatch(bodyStr, -1)
-	fmt.Printf("Found %d text matches for SKU pattern\n", len(textMatches))
+	slog.Debug("Found text matches for SKU pattern", "count", len(textMatches))
 	for _, match := range textMatches {
 		if len(match) > 1 {
 			sku := match[1]
 			if !skuMap[sku] && !existingSKUs[sku] {
 				skus = append(skus, sku)
 				skuMap[sku] = true
-				fmt.Printf("Extracted SKU from text: %s\n", sku)
+				slog.Debug("Extracted SKU from text", "sku", sku)
 			}
 		}
 	}
 
-	if len(skus) == 0 {
-		fmt.Printf("No SKUs extracted from %s\n", filePath)
-	}
-	return skus, nil
+	return skus
 }
 
 func appendSKUs(skus []string, filename string) error {
@@ -91,30 +98,31 @@ func appendSKUs(skus []string, filename string) error {
 	return nil
 }
 
-func main() {
-	fmt.Println("Starting SKU extractor for HTML file...")
+// extractSKUsMain appends the SKUs found in a saved category page to
+// skus_from_html.txt. Run it with "go run . extract-skus".
+func extractSKUsMain() {
+	slog.Info("Starting SKU extractor for HTML file")
 
 	htmlFile := "response_page_1750670937220652501.html"
 
 	existingSKUs, err := loadExistingSKUs("skus_from_html.txt")
 	if err != nil {
-		fmt.Printf("Failed to load existing SKUs: %v\n", err)
+		slog.Error("Failed to load existing SKUs", "error", err)
 		return
 	}
-	fmt.Printf("Loaded %d existing SKUs from skus_from_html.txt\n", len(existingSKUs))
+	slog.Info("Loaded existing SKUs", "file", "skus_from_html.txt", "count", len(existingSKUs))
 
 	skus, err := extractSKUsFromHTML(htmlFile, existingSKUs)
 	if err != nil {
-		fmt.Printf("Failed to extract SKUs: %v\n", err)
+		slog.Error("Failed to extract SKUs", "error", err)
 		return
 	}
 
-	fmt.Printf("Extracted %d unique SKUs\n", len(skus))
+	slog.Info("Extracted unique SKUs", "count", len(skus))
 
-	fmt.Println("Appending SKUs to skus_from_html.txt...")
 	if err := appendSKUs(skus, "skus_from_html.txt"); err != nil {
-		fmt.Printf("Failed to save SKUs: %v\n", err)
+		slog.Error("Failed to save SKUs", "error", err)
 		return
 	}
-	fmt.Printf("Successfully appended %d\n", len(skus))
+	slog.Info("Appended SKUs", "file", "skus_from_html.txt", "count", len(skus))
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaterialShare is one material of a composition such as "綿60%、ポリエステル40%".
+type MaterialShare struct {
+	Material string  `json:"material"` // canonical English name, e.g. "polyester"
+	Label    string  `json:"label"`    // as written in the product text
+	Percent  float64 `json:"percent"`
+	Recycled bool    `json:"recycled,omitempty"`
+}
+
+// materialNames maps the material names found in product texts to canonical
+// English names. English names match whole words, Japanese names anywhere in
+// the label and tokens only the whole label, since they also occur inside
+// unrelated words (毛 in 起毛, brushed).
+var materialNames = []struct {
+	material string
+	english  []string
+	japanese []string
+	tokens   []string
+}{
+	{"cotton", []string{"cotton"}, []string{"綿", "コットン"}, nil},
+	{"polyester", []string{"polyester"}, []string{"ポリエステル"}, nil},
+	{"nylon", []string{"nylon", "polyamide"}, []string{"ナイロン", "ポリアミド"}, nil},
+	{"elastane", []string{"elastane", "spandex", "polyurethane"}, []string{"ポリウレタン", "エラスタン", "スパンデックス"}, nil},
+	{"rayon", []string{"rayon", "viscose"}, []string{"レーヨン", "ビスコース"}, nil},
+	{"wool", []string{"wool"}, []string{"ウール"}, []string{"毛"}},
+	{"acrylic", []string{"acrylic"}, []string{"アクリル"}, nil},
+	{"linen", []string{"linen"}, []string{"リネン", "麻"}, nil},
+	{"polypropylene", []string{"polypropylene"}, []string{"ポリプロピレン"}, nil},
+	{"leather", []string{"leather"}, []string{"レザー", "革"}, nil},
+	{"rubber", []string{"rubber"}, []string{"ラバー", "ゴム"}, nil},
+}
+
+var (
+	// A material followed by its share, as in Japanese texts and "Cotton 100%".
+	materialBeforeRe = regexp.MustCompile(`([^\s\d%％、。,，/／:：・()（）]+)\s*(\d{1,3}(?:\.\d+)?)\s*[%％]`)
+	// A share followed by its material, as in "100% recycled polyester".
+	materialAfterRe = regexp.MustCompile(`(?i)(\d{1,3}(?:\.\d+)?)\s*%\s*((?:recycled\s+)?[a-z]+)`)
+	recycledRe      = regexp.MustCompile(`(?i)recycled|リサイクル|再生`)
+)
+
+// matchMaterial returns the canonical name of the material in label.
+func matchMaterial(label string) (string, bool) {
+	words := strings.Fields(strings.ToLower(label))
+	for _, m := range materialNames {
+		for _, word := range words {
+			if containsString(m.english, word) {
+				return m.material, true
+			}
+		}
+		for _, name := range m.japanese {
+			if strings.Contains(label, name) {
+				return m.material, true
+			}
+		}
+		if containsString(m.tokens, recycledRe.ReplaceAllString(label, "")) {
+			return m.material, true
+		}
+	}
+	return "", false
+}
+
+// extractMaterials finds material percentages in texts. Only known
+// materials are kept, so phrases like "with 100%" are not mistaken for one.
+func extractMaterials(texts []string) []MaterialShare {
+	var shares []MaterialShare
+	add := func(label, percent string) {
+		material, ok := matchMaterial(label)
+		if !ok {
+			return
+		}
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return
+		}
+		share := MaterialShare{Material: material, Label: label, Percent: p, Recycled: recycledRe.MatchString(label)}
+		for _, s := range shares {
+			if s == share {
+				return
+			}
+		}
+		shares = append(shares, share)
+	}
+	for _, text := range texts {
+		for _, m := range materialBeforeRe.FindAllStringSubmatch(text, -1) {
+			add(m[1], m[2])
+		}
+		for _, m := range materialAfterRe.FindAllStringSubmatch(text, -1) {
+			add(m[2], m[1])
+		}
+	}
+	return shares
+}
+
+// technologyTags lists adidas technologies with their canonical spelling.
+// Tags that are also ordinary words carry the full names that identify them
+// in free text.
+var technologyTags = []struct {
+	tag       string
+	fullNames []string
+}{
+	{tag: "AEROREADY"}, {tag: "HEAT.RDY"}, {tag: "COLD.RDY"}, {tag: "RAIN.RDY"},
+	{tag: "WIND.RDY"}, {tag: "Climacool"}, {tag: "Climawarm"}, {tag: "Primegreen"},
+	{tag: "Primeblue"}, {tag: "Primeknit"},
+	{tag: "Parley", fullNames: []string{"Parley Ocean Plastic", "Parley for the Oceans"}},
+	{tag: "BOOST", fullNames: []string{"BOOST ミッドソール", "BOOST midsole", "BOOST cushioning"}},
+	{tag: "Lightstrike"}, {tag: "Lightmotion"},
+	{tag: "Bounce", fullNames: []string{"Bounce ミッドソール", "Bounce midsole", "Bounce cushioning"}},
+	{tag: "Cloudfoam"}, {tag: "Dreamstrike"}, {tag: "4DFWD"},
+	{tag: "Continental", fullNames: []string{"Continental™", "Continental ラバー", "Continental rubber"}},
+	{tag: "GORE-TEX"},
+}
+
+// technologyRes holds, per entry of technologyTags, the pattern matched in
+// titles and highlights and the one matched in descriptions.
+var technologyRes = func() [][2]*regexp.Regexp {
+	res := make([][2]*regexp.Regexp, len(technologyTags))
+	for i, t := range technologyTags {
+		res[i][0] = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(t.tag) + `\b`)
+		res[i][1] = res[i][0]
+		if len(t.fullNames) > 0 {
+			names := make([]string, len(t.fullNames))
+			for j, name := range t.fullNames {
+				words := strings.Fields(name)
+				for k, word := range words {
+					words[k] = regexp.QuoteMeta(word)
+				}
+				names[j] = strings.Join(words, `\s*`)
+			}
+			res[i][1] = regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)`)
+		}
+	}
+	return res
+}()
+
+// extractTechnologies returns the technology tags mentioned in highlights
+// (the title and structured attributes) or, by their full names, in prose,
+// in the order of technologyTags.
+func extractTechnologies(highlights, prose []string) []string {
+	var tags []string
+	joinedHighlights, joinedProse := strings.Join(highlights, "\n"), strings.Join(prose, "\n")
+	for i, re := range technologyRes {
+		if re[0].MatchString(joinedHighlights) || re[1].MatchString(joinedProse) {
+			tags = append(tags, technologyTags[i].tag)
+		}
+	}
+	return tags
+}
+
+// classifyFeatures fills MaterialContent from the USPs, materials,
+// functions and description of p, and Technologies from the same texts plus
+// the name, with only full technology names counted in the description.
+func classifyFeatures(p *ProductData) {
+	var highlights []string
+	highlights = append(highlights, p.USPs...)
+	highlights = append(highlights, p.Materials...)
+	highlights = append(highlights, p.Functions...)
+	p.MaterialContent = extractMaterials(append(highlights, p.Description))
+	p.Technologies = extractTechnologies(append([]string{p.Name}, highlights...), []string{p.Description})
+}
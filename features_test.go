@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractMaterials(t *testing.T) {
+	got := extractMaterials([]string{
+		"本体：綿60%、リサイクルポリエステル40%",
+		"Made with 100% recycled polyester",
+		"リブ部分 ポリウレタン 5％",
+		"綿60%",
+		"起毛ポリエステル100%",
+		"毛30%、起毛10%",
+	})
+	want := []MaterialShare{
+		{Material: "cotton", Label: "綿", Percent: 60},
+		{Material: "polyester", Label: "リサイクルポリエステル", Percent: 40, Recycled: true},
+		{Material: "polyester", Label: "recycled polyester", Percent: 100, Recycled: true},
+		{Material: "elastane", Label: "ポリウレタン", Percent: 5},
+		{Material: "polyester", Label: "起毛ポリエステル", Percent: 100},
+		{Material: "wool", Label: "毛", Percent: 30},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractMaterials = %+v, want %+v", got, want)
+	}
+}
+
+func TestExtractTechnologies(t *testing.T) {
+	got := extractTechnologies([]string{"汗を素早く吸収するAEROREADY", "heat.rdy keeps you cool", "Primegreen素材を使用", "BOOSTER"}, nil)
+	if want := []string{"AEROREADY", "HEAT.RDY", "Primegreen"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extractTechnologies = %q, want %q", got, want)
+	}
+
+	// In descriptions, tags that are also ordinary words count only by
+	// their full names.
+	got = extractTechnologies([]string{"Ultraboost 5 ランニングシューズ"}, []string{
+		"A bounce in your step on continental trips. Boost your day.",
+		"Bounce ミッドソールとContinental™ Rubberアウトソールを搭載。AEROREADYで快適。",
+	})
+	if want := []string{"AEROREADY", "Bounce", "Continental"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extractTechnologies in prose = %q, want %q", got, want)
+	}
+	if got := extractTechnologies([]string{"Bounce Sportswear Shoes"}, nil); !reflect.DeepEqual(got, []string{"Bounce"}) {
+		t.Errorf("extractTechnologies in title = %q, want [Bounce]", got)
+	}
+}
+
+func TestParseProductSeparatesFeatures(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "products", "KB5435.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseProduct("KB5435", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"半袖", "オーバーサイズ"}; !reflect.DeepEqual(p.Functions, want) {
+		t.Errorf("Functions = %q, want %q", p.Functions, want)
+	}
+	if want := []string{"ルーズフィット"}; !reflect.DeepEqual(p.Fit, want) {
+		t.Errorf("Fit = %q, want %q", p.Fit, want)
+	}
+	if p.MaterialContent != nil {
+		t.Errorf("MaterialContent = %+v before classification", p.MaterialContent)
+	}
+	classifyFeatures(p)
+	if want := []MaterialShare{{Material: "polyester", Label: "ポリエステル", Percent: 100}}; !reflect.DeepEqual(p.MaterialContent, want) {
+		t.Errorf("MaterialContent = %+v, want %+v", p.MaterialContent, want)
+	}
+}
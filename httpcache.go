@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpCache keeps API responses on disk with their validators, so later runs
+// can revalidate them with conditional requests instead of downloading them
+// again. Entries are stored at <dir>/<xx>/<sha256 of the URL>.json.
+type httpCache struct {
+	dir    string
+	maxAge time.Duration // when > 0, entries are fresh this long whatever the server said
+	now    func() time.Time
+}
+
+// cacheEntry is a cached response. Expires is when it has to be revalidated;
+// the zero time means on every use.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	StoredAt     time.Time `json:"stored_at"` // last download or revalidation
+	Expires      time.Time `json:"expires"`
+	Body         []byte    `json:"body"`
+}
+
+func newHTTPCache(dir string, maxAge time.Duration) (*httpCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create HTTP cache directory %s: %v", dir, err)
+	}
+	return &httpCache{dir: dir, maxAge: maxAge, now: time.Now}, nil
+}
+
+func (c *httpCache) path(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// lookup returns the cached response for rawURL, or nil. A nil cache caches
+// nothing.
+func (c *httpCache) lookup(rawURL string) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(rawURL))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != rawURL {
+		return nil
+	}
+	return &entry
+}
+
+// fresh reports whether entry may be used without asking the server.
+func (c *httpCache) fresh(entry *cacheEntry) bool {
+	if c.maxAge > 0 {
+		return c.now().Before(entry.StoredAt.Add(c.maxAge))
+	}
+	return c.now().Before(entry.Expires)
+}
+
+// conditional adds the validators of entry to req.
+func (e *cacheEntry) conditional(req *http.Request) {
+	if e == nil {
+		return
+	}
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// store caches a 200 response and reports whether it did. Responses are not
+// stored when Cache-Control forbids it, or when there is nothing to
+// revalidate them with and they are not fresh for any time.
+func (c *httpCache) store(rawURL string, header http.Header, body []byte) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	now := c.now()
+	expires, cacheable := freshUntil(header, now)
+	entry := &cacheEntry{
+		URL:          rawURL,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		StoredAt:     now,
+		Expires:      expires,
+		Body:         body,
+	}
+	if !cacheable || (entry.ETag == "" && entry.LastModified == "" && !expires.After(now) && c.maxAge <= 0) {
+		return false, nil
+	}
+	if err := c.write(entry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revalidate records that the server answered 304 Not Modified for entry,
+// taking over the new freshness and validators it sent.
+func (c *httpCache) revalidate(entry *cacheEntry, header http.Header) error {
+	now := c.now()
+	entry.StoredAt = now
+	entry.Expires, _ = freshUntil(header, now)
+	if etag := header.Get("ETag"); etag != "" {
+		entry.ETag = etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		entry.LastModified = lastModified
+	}
+	return c.write(entry)
+}
+
+func (c *httpCache) write(entry *cacheEntry) error {
+	path := c.path(entry.URL)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+	return nil
+}
+
+// freshUntil works out from Cache-Control, Age and Expires how long a
+// response received at now is fresh, and whether it may be stored at all.
+// no-cache responses are stored but revalidated on every use.
+func freshUntil(header http.Header, now time.Time) (time.Time, bool) {
+	maxAge, hasMaxAge := time.Duration(0), false
+	noStore, noCache := false, false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			noStore = true
+		case "no-cache":
+			noCache = true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				maxAge, hasMaxAge = time.Duration(seconds)*time.Second, true
+			}
+		}
+	}
+	switch {
+	case noStore:
+		return time.Time{}, false
+	case noCache:
+		return time.Time{}, true
+	case hasMaxAge:
+		if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+			maxAge -= time.Duration(age) * time.Second
+		}
+		if maxAge <= 0 {
+			return time.Time{}, true
+		}
+		return now.Add(maxAge), true
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			// Judge Expires by the server's clock.
+			expires = now.Add(expires.Sub(date))
+		}
+		if expires.After(now) {
+			return expires, true
+		}
+	}
+	return time.Time{}, true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFreshUntil(t *testing.T) {
+	now := time.Date(2025, 6, 20, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header    http.Header
+		want      time.Time
+		cacheable bool
+	}{
+		{http.Header{}, time.Time{}, true},
+		{http.Header{"Cache-Control": {"public, max-age=300"}}, now.Add(5 * time.Minute), true},
+		{http.Header{"Cache-Control": {"max-age=300"}, "Age": {"100"}}, now.Add(200 * time.Second), true},
+		{http.Header{"Cache-Control": {"max-age=300, no-cache"}}, time.Time{}, true},
+		{http.Header{"Cache-Control": {"no-cache, no-store"}}, time.Time{}, false},
+		// Expires is judged by the server's clock, ten minutes after its Date.
+		{http.Header{"Date": {"Fri, 20 Jun 2025 08:00:00 GMT"}, "Expires": {"Fri, 20 Jun 2025 08:10:00 GMT"}}, now.Add(10 * time.Minute), true},
+		{http.Header{"Expires": {"0"}}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, cacheable := freshUntil(tt.header, now)
+		if !got.Equal(tt.want) || cacheable != tt.cacheable {
+			t.Errorf("freshUntil(%v) = %v, %v, want %v, %v", tt.header, got, cacheable, tt.want, tt.cacheable)
+		}
+	}
+}
+
+func TestHTTPCacheRevalidatesProducts(t *testing.T) {
+	m := newMockAdidas(t)
+	session, _ := newMockSession(m, 0)
+	cache, err := newHTTPCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.cache = cache
+
+	first, err := session.getProductDetails("IA4845")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.unchanged["IA4845"] {
+		t.Error("first download marked unchanged")
+	}
+
+	// The mock sends no Cache-Control, so the entry is revalidated with
+	// If-None-Match and the mock answers 304.
+	second, err := session.getProductDetails("IA4845")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("product from the cache differs from the downloaded one")
+	}
+	if !session.unchanged["IA4845"] {
+		t.Error("304 response not marked unchanged")
+	}
+	if got := m.requestCount("/api/products/IA4845"); got != 2 {
+		t.Errorf("product requested %d times, want 2", got)
+	}
+
+	// With a max-age override the entry is fresh and no request is sent.
+	cache.maxAge = time.Hour
+	if _, err := session.getProductDetails("IA4845"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.requestCount("/api/products/IA4845"); got != 2 {
+		t.Errorf("product requested %d times with -http-cache-max-age, want 2", got)
+	}
+}
+
+func TestRunReportCountsNotModifiedAsUnchanged(t *testing.T) {
+	m := newMockAdidas(t)
+	session, _ := newMockSession(m, 0)
+	session.unchanged["IA4845"] = true
+
+	start := time.Date(2025, 6, 23, 9, 0, 0, 0, time.UTC)
+	prev := newRunReport("runs/20250622T090000Z", start.Add(-24*time.Hour))
+	prev.recordSuccess(&ProductData{ID: "IA4845", Price: "5000 JPY"})
+	prev.recordSuccess(&ProductData{ID: "KB5435", Price: "5000 JPY"})
+
+	// Both hashes differ, e.g. after a parser change, but the server said
+	// IA4845 did not change.
+	r := newRunReport("runs/20250623T090000Z", start)
+	r.recordSuccess(&ProductData{ID: "IA4845", Price: "5000 JPY", Brand: "adidas"})
+	r.recordSuccess(&ProductData{ID: "KB5435", Price: "4000 JPY"})
+	r.finish(session, []string{"IA4845", "KB5435"}, prev, start.Add(time.Minute))
+
+	if !reflect.DeepEqual(r.Changed, []string{"KB5435"}) || !reflect.DeepEqual(r.Unchanged, []string{"IA4845"}) {
+		t.Errorf("changed = %v, unchanged = %v", r.Changed, r.Unchanged)
+	}
+}
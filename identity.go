@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Request destinations, sent as Sec-Fetch-Dest. They decide which Accept,
+// Sec-Fetch-Mode and navigation headers a browser identity sends.
+const (
+	destAPI      = "empty"    // fetch()/XHR calls such as /api/products
+	destDocument = "document" // page navigations such as category listings
+	destImage    = "image"
+)
+
+// browserIdentity is one coherent browser: its User-Agent, client hints,
+// Accept headers, Accept-Language and which headers it sends. A
+// session keeps one identity, together with its cookie jar, for its whole
+// lifetime; a new identity is only picked for a new session.
+type browserIdentity struct {
+	Name           string
+	UserAgent      string
+	AcceptLanguage string
+	// ClientHints are the sec-ch-ua headers. Only Chromium-based browsers
+	// send them; Safari and Firefox leave them out.
+	ClientHints map[string]string
+	// Accept by request destination.
+	Accept map[string]string
+	// Headers is the set of header names the browser sends; others are
+	// left out. It says nothing about their order: net/http writes
+	// HTTP/1.1 headers sorted by name and HTTP/2 in its own order, so the
+	// browser's header order is not reproduced.
+	Headers map[string]bool
+}
+
+// acceptEncoding is the same for every identity: real browsers also offer
+// zstd, which readResponseBody cannot decode.
+const acceptEncoding = "gzip, deflate, br"
+
+var chromeAccept = map[string]string{
+	destAPI:      "application/json, text/plain, */*",
+	destDocument: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+	destImage:    "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8",
+}
+
+var chromeHeaders = headerSet(
+	"Accept", "Accept-Encoding", "Accept-Language", "Connection", "Referer",
+	"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User",
+	"Upgrade-Insecure-Requests", "User-Agent", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+)
+
+var safariAccept = map[string]string{
+	destAPI:      "application/json, text/plain, */*",
+	destDocument: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	destImage:    "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5",
+}
+
+var safariHeaders = headerSet(
+	"Accept", "Accept-Encoding", "Accept-Language", "Connection", "Referer",
+	"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Upgrade-Insecure-Requests", "User-Agent",
+)
+
+func headerSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// browserIdentities are the profiles sessions pick from.
+var browserIdentities = []*browserIdentity{
+	{
+		Name:           "chrome-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+		AcceptLanguage: "ja,en-US;q=0.9,en;q=0.8",
+		ClientHints: map[string]string{
+			"sec-ch-ua":          `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"sec-ch-ua-mobile":   "?0",
+			"sec-ch-ua-platform": `"Windows"`,
+		},
+		Accept:  chromeAccept,
+		Headers: chromeHeaders,
+	},
+	{
+		Name:           "chrome-macos",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+		AcceptLanguage: "ja,en-US;q=0.9,en;q=0.8",
+		ClientHints: map[string]string{
+			"sec-ch-ua":          `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"sec-ch-ua-mobile":   "?0",
+			"sec-ch-ua-platform": `"macOS"`,
+		},
+		Accept:  chromeAccept,
+		Headers: chromeHeaders,
+	},
+	{
+		Name:           "safari-iphone",
+		UserAgent:      "Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1",
+		AcceptLanguage: "ja-JP,ja;q=0.9",
+		Accept:         safariAccept,
+		Headers:        safariHeaders,
+	},
+	{
+		Name:           "safari-macos",
+		UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+		AcceptLanguage: "ja-JP,ja;q=0.9",
+		Accept:         safariAccept,
+		Headers:        safariHeaders,
+	},
+	{
+		Name:           "firefox-windows",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		AcceptLanguage: "ja,en-US;q=0.7,en;q=0.3",
+		Accept: map[string]string{
+			destAPI:      "application/json, text/plain, */*",
+			destDocument: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/png,image/svg+xml,*/*;q=0.8",
+			destImage:    "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5",
+		},
+		Headers: headerSet(
+			"Accept", "Accept-Encoding", "Accept-Language", "Connection", "Referer",
+			"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User",
+			"Upgrade-Insecure-Requests", "User-Agent",
+		),
+	},
+}
+
+func identityNames() []string {
+	var names []string
+	for _, id := range browserIdentities {
+		names = append(names, id.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupIdentity returns the named identity, or a random one for "" and
+// "random".
+func lookupIdentity(name string) (*browserIdentity, error) {
+	if name == "" || name == "random" {
+		return browserIdentities[rand.Intn(len(browserIdentities))], nil
+	}
+	for _, id := range browserIdentities {
+		if id.Name == name {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown browser identity %q (want random or one of %s)", name, strings.Join(identityNames(), ", "))
+}
+
+// headers returns the headers the browser sends for a request to dest.
+// site is the Sec-Fetch-Site value.
+func (id *browserIdentity) headers(dest, site, referer string) map[string]string {
+	values := map[string]string{
+		"Connection":      "keep-alive",
+		"User-Agent":      id.UserAgent,
+		"Accept":          id.Accept[dest],
+		"Accept-Language": id.AcceptLanguage,
+		"Accept-Encoding": acceptEncoding,
+		"Sec-Fetch-Dest":  dest,
+		"Sec-Fetch-Site":  site,
+		"Referer":         referer,
+	}
+	switch dest {
+	case destDocument:
+		values["Sec-Fetch-Mode"] = "navigate"
+		values["Sec-Fetch-User"] = "?1"
+		values["Upgrade-Insecure-Requests"] = "1"
+	case destImage:
+		values["Sec-Fetch-Mode"] = "no-cors"
+	default:
+		values["Sec-Fetch-Mode"] = "cors"
+	}
+	for name, value := range id.ClientHints {
+		values[name] = value
+	}
+
+	headers := make(map[string]string)
+	for name, value := range values {
+		if id.Headers[name] && value != "" {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// apply sets the identity's headers on req.
+func (id *browserIdentity) apply(req *http.Request, dest, site, referer string) {
+	for name, value := range id.headers(dest, site, referer) {
+		req.Header.Set(name, value)
+	}
+}
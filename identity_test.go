@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIdentitiesAreCoherent(t *testing.T) {
+	for _, id := range browserIdentities {
+		headers := id.headers(destAPI, "same-origin", "https://www.adidas.jp/")
+		chromium := strings.Contains(id.UserAgent, "Chrome/")
+		if _, ok := headers["sec-ch-ua"]; ok != chromium {
+			t.Errorf("%s: sends sec-ch-ua = %v, but Chrome UA = %v", id.Name, ok, chromium)
+		}
+		if platform := headers["sec-ch-ua-platform"]; platform != "" {
+			if (platform == `"Windows"`) != strings.Contains(id.UserAgent, "Windows") {
+				t.Errorf("%s: platform hint %s does not match UA %s", id.Name, platform, id.UserAgent)
+			}
+		}
+		for _, name := range []string{"User-Agent", "Accept", "Accept-Language", "Sec-Fetch-Mode"} {
+			if headers[name] == "" {
+				t.Errorf("%s: missing %s", id.Name, name)
+			}
+		}
+		if headers["Upgrade-Insecure-Requests"] != "" || headers["Sec-Fetch-User"] != "" {
+			t.Errorf("%s: API call sent navigation headers", id.Name)
+		}
+	}
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	id, err := lookupIdentity("safari-iphone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range id.headers(destDocument, "same-origin", "https://www.adidas.jp/") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := "Accept Accept-Encoding Accept-Language Connection Referer Sec-Fetch-Dest Sec-Fetch-Mode Sec-Fetch-Site Upgrade-Insecure-Requests User-Agent"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("headers = %s\nwant      %s", got, want)
+	}
+
+	if _, err := lookupIdentity("netscape"); err == nil {
+		t.Error("unknown identity accepted")
+	}
+}
+
+// TestSessionKeepsIdentity checks that every request of a session, API or
+// page, presents the same browser.
+func TestSessionKeepsIdentity(t *testing.T) {
+	var agents []string
+	var modes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		modes = append(modes, r.Header.Get("Sec-Fetch-Mode"))
+		if r.Header.Get("sec-ch-ua") != "" {
+			t.Errorf("Firefox identity sent sec-ch-ua")
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	id, _ := lookupIdentity("firefox-windows")
+	session := NewScrapingSession(SessionOptions{BaseURL: server.URL, Identity: id})
+	session.limiter = newRateLimiter(0, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := session.makeRequest(server.URL+"/api/products/IA4845", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := session.fetch(server.URL+"/メンズ-tシャツ", 1, requestOptions{dest: destDocument}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ua := range agents {
+		if ua != id.UserAgent {
+			t.Errorf("request sent User-Agent %s, want %s", ua, id.UserAgent)
+		}
+	}
+	if strings.Join(modes, ",") != "cors,cors,cors,navigate" {
+		t.Errorf("Sec-Fetch-Mode = %v", modes)
+	}
+}
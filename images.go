@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ImageOptions configures the optional image download stage.
+type ImageOptions struct {
+	Dir   string
+	Sizes []string // widths to request from the asset CDN; empty keeps the listed URL
+}
+
+// imageRecord is one downloaded file of a product in the manifest.
+type imageRecord struct {
+	URL    string `json:"url"`
+	Size   string `json:"size,omitempty"`
+	SHA256 string `json:"sha256"`
+	Path   string `json:"path"`
+	Bytes  int    `json:"bytes"`
+}
+
+// imageManifest maps product IDs to their files and remembers which URLs were
+// already downloaded so reruns skip them.
+type imageManifest struct {
+	Products map[string][]imageRecord `json:"products"`
+	URLs     map[string]imageRecord   `json:"urls"`
+}
+
+// imageSink downloads product images into a content-addressed store: each
+// file is named after the SHA-256 of its contents, so identical images shared
+// between products or runs are stored once.
+type imageSink struct {
+	session  *ScrapingSession
+	opts     ImageOptions
+	manifest imageManifest
+}
+
+func newImageSink(session *ScrapingSession, opts ImageOptions) (*imageSink, error) {
+	if err := os.MkdirAll(filepath.Join(opts.Dir, "objects"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create image directory %s: %v", opts.Dir, err)
+	}
+	sink := &imageSink{
+		session: session,
+		opts:    opts,
+		manifest: imageManifest{
+			Products: make(map[string][]imageRecord),
+			URLs:     make(map[string]imageRecord),
+		},
+	}
+
+	data, err := os.ReadFile(sink.manifestPath())
+	if err == nil {
+		if err := json.Unmarshal(data, &sink.manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse image manifest: %v", err)
+		}
+		slog.Info("Loaded image manifest", "products", len(sink.manifest.Products), "urls", len(sink.manifest.URLs))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read image manifest: %v", err)
+	}
+	return sink, nil
+}
+
+func (s *imageSink) manifestPath() string {
+	return filepath.Join(s.opts.Dir, "manifest.json")
+}
+
+func (s *imageSink) Name() string { return "images" }
+
+// imageWidthRe matches the width transformation in asset URLs such as
+// https://assets.adidas.com/images/w_600,f_auto,q_auto/<hash>/<name>.jpg.
+var imageWidthRe = regexp.MustCompile(`/images/w_\d+,`)
+
+// imageVariantURL returns the URL of the requested width of an asset. URLs
+// without a width transformation are returned unchanged.
+func imageVariantURL(raw, width string) string {
+	if width == "" || !imageWidthRe.MatchString(raw) {
+		return raw
+	}
+	return imageWidthRe.ReplaceAllString(raw, "/images/w_"+width+",")
+}
+
+func imageExtension(rawURL string, body []byte) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && len(ext) <= 5 {
+			return ext
+		}
+	}
+	switch http.DetectContentType(body) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	}
+	return ".bin"
+}
+
+func (s *imageSink) WriteProduct(p *ProductData) error {
+	sizes := s.opts.Sizes
+	if len(sizes) == 0 {
+		sizes = []string{""}
+	}
+
+	var records []imageRecord
+	var failed []string
+	seen := make(map[string]bool)
+	for _, imageURL := range p.Images {
+		for _, size := range sizes {
+			variant := imageVariantURL(imageURL, size)
+			if seen[variant] {
+				continue
+			}
+			seen[variant] = true
+
+			record, err := s.download(variant)
+			if err != nil {
+				slog.Error("Failed to download image", "id", p.ID, "url", variant, "error", err)
+				failed = append(failed, variant)
+				continue
+			}
+			record.Size = size
+			records = append(records, record)
+		}
+	}
+
+	s.manifest.Products[p.ID] = records
+	if err := s.saveManifest(); err != nil {
+		return err
+	}
+	slog.Debug("Stored images", "id", p.ID, "images", len(records))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d images failed", len(failed), len(failed)+len(records))
+	}
+	return nil
+}
+
+func (s *imageSink) download(imageURL string) (imageRecord, error) {
+	if record, ok := s.manifest.URLs[imageURL]; ok {
+		if _, err := os.Stat(filepath.Join(s.opts.Dir, record.Path)); err == nil {
+			return record, nil
+		}
+	}
+
+	body, err := s.session.fetch(imageURL, 3, requestOptions{dest: destImage})
+	if err != nil {
+		return imageRecord{}, err
+	}
+
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	rel := filepath.Join("objects", hash[:2], hash+imageExtension(imageURL, body))
+	full := filepath.Join(s.opts.Dir, rel)
+	if _, err := os.Stat(full); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return imageRecord{}, err
+		}
+		if err := writeFileAtomic(full, body); err != nil {
+			return imageRecord{}, err
+		}
+	}
+
+	record := imageRecord{URL: imageURL, SHA256: hash, Path: rel, Bytes: len(body)}
+	s.manifest.URLs[imageURL] = record
+	return record, nil
+}
+
+func (s *imageSink) saveManifest() error {
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode image manifest: %v", err)
+	}
+	if err := writeFileAtomic(s.manifestPath(), data); err != nil {
+		return fmt.Errorf("failed to write image manifest: %v", err)
+	}
+	return nil
+}
+
+func (s *imageSink) Close() error {
+	if err := s.saveManifest(); err != nil {
+		return err
+	}
+	slog.Info("Closed image store", "dir", s.opts.Dir, "products", len(s.manifest.Products), "urls", len(s.manifest.URLs))
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and renames
+// it into place, so readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
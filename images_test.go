@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageVariantURL(t *testing.T) {
+	raw := "https://assets.adidas.com/images/w_600,f_auto,q_auto/bf9d73fb/T_IA4845_01_laydown.jpg"
+	want := "https://assets.adidas.com/images/w_1200,f_auto,q_auto/bf9d73fb/T_IA4845_01_laydown.jpg"
+	if got := imageVariantURL(raw, "1200"); got != want {
+		t.Errorf("imageVariantURL = %s, want %s", got, want)
+	}
+	if got := imageVariantURL("https://example.com/a.jpg", "1200"); got != "https://example.com/a.jpg" {
+		t.Errorf("URL without width changed: %s", got)
+	}
+}
+
+func TestImageSinkDedupesContent(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("same bytes for every image"))
+	}))
+	defer server.Close()
+
+	session := NewScrapingSession(SessionOptions{})
+	session.limiter = newRateLimiter(0, 0)
+	dir := t.TempDir()
+
+	sink, err := newImageSink(session, ImageOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	products := []*ProductData{
+		{ID: "IA4845", Images: []string{server.URL + "/a.jpg", server.URL + "/b.jpg"}},
+		{ID: "IA4846", Images: []string{server.URL + "/a.jpg"}},
+	}
+	for _, p := range products {
+		if err := sink.WriteProduct(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2 (a.jpg fetched once)", requests)
+	}
+	objects, _ := filepath.Glob(filepath.Join(dir, "objects", "*", "*.jpg"))
+	if len(objects) != 1 {
+		t.Errorf("stored %d objects, want 1: %v", len(objects), objects)
+	}
+
+	// A second run reuses the manifest and downloads nothing.
+	rerun, err := newImageSink(session, ImageOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rerun.WriteProduct(products[0]); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("rerun made %d extra requests", requests-2)
+	}
+	if len(rerun.manifest.Products["IA4845"]) != 2 {
+		t.Errorf("manifest for IA4845 = %v", rerun.manifest.Products["IA4845"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err != nil {
+		t.Error(err)
+	}
+}
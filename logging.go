@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logConfig holds the logging flags shared by every command.
+type logConfig struct {
+	level   string
+	format  string
+	verbose bool
+}
+
+func (c *logConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.level, "log-level", "info", "minimum log level: debug, info, warn or error")
+	fs.StringVar(&c.format, "log-format", "text", "log format: text or json")
+	fs.BoolVar(&c.verbose, "verbose", false, "log raw API responses, every parsed product field and file sizes (implies -log-level debug)")
+}
+
+// setup installs the configured handler as the default slog logger.
+func (c *logConfig) setup() error {
+	level := c.level
+	if c.verbose {
+		level = "debug"
+	}
+	handler, err := newLogHandler(os.Stderr, level, c.format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q (want text or json)", format)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newLogHandler(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(handler)
+	logger.Debug("Parsed product", "id", "IA4845")
+	logger.Info("Fetched product", "id", "IA4845", "n", 1, "total", 2)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines at info, want 1: %q", len(lines), lines)
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "Fetched product" || record["id"] != "IA4845" || record["level"] != "INFO" {
+		t.Errorf("record = %v", record)
+	}
+
+	if _, err := newLogHandler(&buf, "loud", "text"); err == nil {
+		t.Error("invalid level accepted")
+	}
+	if _, err := newLogHandler(&buf, "info", "xml"); err == nil {
+		t.Error("invalid format accepted")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import "fmt"
+
+// WriteMode controls what the file outputs do with products that already have
+// a row from an earlier run.
+type WriteMode string
+
+const (
+	// ModeAppend keeps earlier rows and appends a row with the next version
+	// number when a product changed.
+	ModeAppend WriteMode = "append"
+	// ModeUpsert overwrites a product's row in place when it changed and
+	// leaves unchanged rows alone.
+	ModeUpsert WriteMode = "upsert"
+	// ModeReplace always overwrites a product's row in place.
+	ModeReplace WriteMode = "replace"
+)
+
+func parseWriteMode(s string) (WriteMode, error) {
+	switch mode := WriteMode(s); mode {
+	case ModeAppend, ModeUpsert, ModeReplace:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown write mode %q (want append, upsert or replace)", s)
+}
+
+// versionHeader names the trailing column that numbers the rows written for
+// the same product ID.
+const versionHeader = "Version"
+
+func outputHeaders() []string {
+	return append(productHeaders(), versionHeader)
+}
+
+type writeAction int
+
+const (
+	actionAppend writeAction = iota
+	actionUpdate
+	actionSkip
+)
+
+// productTable holds the rows of a file output keyed by product ID. Each row
+// is a product record followed by its version.
+type productTable struct {
+	rows   [][]string
+	latest map[string]int
+
+	appended, updated, skipped int
+}
+
+func newProductTable() *productTable {
+	return &productTable{latest: make(map[string]int)}
+}
+
+// load adds a row read from an existing file.
+func (t *productTable) load(row []string) {
+	t.rows = append(t.rows, row)
+	t.latest[row[0]] = len(t.rows) - 1
+}
+
+func sameProductRecord(row, record []string) bool {
+	for i := range record {
+		if row[i] != record[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// apply merges a freshly encoded product record according to mode and returns
+// what the output has to do along with the affected row index.
+func (t *productTable) apply(record []string, mode WriteMode) (writeAction, int) {
+	idx, ok := t.latest[record[0]]
+	if !ok {
+		t.load(append(record, "1"))
+		t.appended++
+		return actionAppend, len(t.rows) - 1
+	}
+
+	prev := t.rows[idx]
+	unchanged := sameProductRecord(prev, record)
+	version := prev[len(prev)-1]
+	if !unchanged {
+		var n int
+		fmt.Sscanf(version, "%d", &n)
+		version = fmt.Sprint(n + 1)
+	}
+
+	switch {
+	case unchanged && mode != ModeReplace:
+		t.skipped++
+		return actionSkip, idx
+	case mode == ModeAppend:
+		t.load(append(record, version))
+		t.appended++
+		return actionAppend, len(t.rows) - 1
+	default:
+		t.rows[idx] = append(record, version)
+		t.updated++
+		return actionUpdate, idx
+	}
+}
+
+func (t *productTable) summary() string {
+	return fmt.Sprintf("%d appended, %d updated, %d unchanged", t.appended, t.updated, t.skipped)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProductTableModes(t *testing.T) {
+	record := func(price string) []string {
+		return productRecord(testProduct("IA4845", price), DefaultCSVOptions())
+	}
+
+	tests := []struct {
+		mode       WriteMode
+		wantAction []writeAction
+		wantRows   int
+		wantLast   string // version of the newest row
+	}{
+		{ModeAppend, []writeAction{actionAppend, actionSkip, actionAppend}, 2, "2"},
+		{ModeUpsert, []writeAction{actionAppend, actionSkip, actionUpdate}, 1, "2"},
+		{ModeReplace, []writeAction{actionAppend, actionUpdate, actionUpdate}, 1, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			table := newProductTable()
+			for i, price := range []string{"4400 JPY", "4400 JPY", "3900 JPY"} {
+				action, _ := table.apply(record(price), tt.mode)
+				if action != tt.wantAction[i] {
+					t.Errorf("write %d: action = %d, want %d", i, action, tt.wantAction[i])
+				}
+			}
+			if len(table.rows) != tt.wantRows {
+				t.Fatalf("rows = %d, want %d", len(table.rows), tt.wantRows)
+			}
+			last := table.rows[table.latest["IA4845"]]
+			if got := last[len(last)-1]; got != tt.wantLast {
+				t.Errorf("version = %s, want %s", got, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestLoadCSVTableUpgradesV1(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "products.csv")
+	legacy := strings.Join(csvSchemaHistory[1], ",") + "\n" +
+		`IA4845,https://shop.adidas.jp/products/IA4845,Tee,4400 JPY,ウェア・服,"J/S,J/M","Black,ホワイト",In Stock,desc,img.jpg,コットン,N/A,N/A,N/A,N/A,N/A,N/A` + "\n"
+	if err := os.WriteFile(filename, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := CSVOptions{JSONLists: true}
+	table, upgrade, err := loadCSVTable(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upgrade {
+		t.Fatal("v1 file not flagged for upgrade")
+	}
+	row := table.rows[table.latest["IA4845"]]
+	if row[5] != `["J/S","J/M"]` || row[6] != `["Black","ホワイト"]` {
+		t.Errorf("lists not re-encoded: sizes=%s colors=%s", row[5], row[6])
+	}
+	if row[len(row)-1] != "1" {
+		t.Errorf("version = %s, want 1", row[len(row)-1])
+	}
+
+	if err := rewriteCSV(filename, table, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCSVSchema(filename, opts); err != nil {
+		t.Errorf("rewritten file does not validate: %v", err)
+	}
+	if err := validateCSVSchema(filename, DefaultCSVOptions()); err == nil {
+		t.Error("validation accepted a different list encoding")
+	}
+}
+
+func TestCSVSinkRewritesUpdatesOnClose(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "products.csv")
+	write := func(prices ...string) *csvSink {
+		sink, err := newCSVSink(filename, DefaultCSVOptions(), ModeUpsert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, id := range []string{"IA4845", "KB5435"} {
+			if err := sink.WriteProduct(&ProductData{ID: id, Price: prices[i]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return sink
+	}
+	if err := write("4400 JPY", "5500 JPY").Close(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := write("3960 JPY", "4950 JPY")
+	if during, _ := os.ReadFile(filename); string(during) != string(before) {
+		t.Error("CSV rewritten before Close")
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	table, _, err := loadCSVTable(filename, DefaultCSVOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.rows) != 2 || table.rows[0][3] != "3960 JPY" || table.rows[1][3] != "4950 JPY" {
+		t.Errorf("rows = %q", table.rows)
+	}
+}
+
+func TestCSVSinkRewritesEveryHundredUpdates(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "products.csv")
+	write := func(price string, n int) *csvSink {
+		sink, err := newCSVSink(filename, DefaultCSVOptions(), ModeUpsert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			if err := sink.WriteProduct(&ProductData{ID: fmt.Sprintf("ID%04d", i), Price: price}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return sink
+	}
+	if err := write("4400 JPY", csvRewriteEvery+1).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The updates reach the file once csvRewriteEvery are pending, without
+	// waiting for Close, and appends keep working after the rewrite.
+	sink := write("3960 JPY", csvRewriteEvery)
+	if err := sink.WriteProduct(&ProductData{ID: "NEW001", Price: "3000 JPY"}); err != nil {
+		t.Fatal(err)
+	}
+	sink.writer.Flush()
+	table, _, err := loadCSVTable(filename, DefaultCSVOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.rows) != csvRewriteEvery+2 || table.rows[0][3] != "3960 JPY" || table.rows[csvRewriteEvery][3] != "4400 JPY" {
+		t.Fatalf("rows before Close: %d, first %q", len(table.rows), table.rows[0])
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// crawlerMetrics are the Prometheus metrics of one crawler process. They are
+// served on /metrics when -metrics-addr is set.
+type crawlerMetrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec   // dest, status ("error" for network errors)
+	requestDuration *prometheus.HistogramVec // dest
+	responseBytes   *prometheus.CounterVec   // dest; bytes read off the wire, before decompression
+	retries         *prometheus.CounterVec   // reason: network, challenge or the status code
+	challenges      *prometheus.CounterVec   // kind
+	robotsBlocked   *prometheus.CounterVec   // host
+	httpCache       *prometheus.CounterVec   // result: fresh, not-modified or stored
+	rateLimitWait   *prometheus.HistogramVec // host
+	products        *prometheus.CounterVec   // result: ok or failed
+	parseFailures   prometheus.Counter
+	schemaDrift     *prometheus.CounterVec // field, problem
+	productsWritten *prometheus.CounterVec // sink
+	sinkErrors      *prometheus.CounterVec // sink
+	proxyUp         *prometheus.GaugeVec   // proxy; 0 while ejected
+	proxyRequests   *prometheus.CounterVec // proxy, result: ok, blocked or error
+	proxyEjections  *prometheus.CounterVec // proxy
+}
+
+func newCrawlerMetrics() *crawlerMetrics {
+	reg := prometheus.NewRegistry()
+	m := &crawlerMetrics{
+		registry: reg,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_http_requests_total",
+			Help: "HTTP requests sent, by request destination and response status.",
+		}, []string{"dest", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "adidas_crawler_http_request_duration_seconds",
+			Help:    "Time until the response headers arrived, by request destination.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"dest"}),
+		responseBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_http_response_bytes_total",
+			Help: "Response body bytes downloaded, before decompression.",
+		}, []string{"dest"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_http_retries_total",
+			Help: "Requests retried, by reason.",
+		}, []string{"reason"}),
+		challenges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_challenges_total",
+			Help: "Bot challenge pages received, by kind.",
+		}, []string{"kind"}),
+		robotsBlocked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_robots_blocked_total",
+			Help: "Requests not sent because robots.txt disallows them, by host.",
+		}, []string{"host"}),
+		httpCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_http_cache_total",
+			Help: "API responses served fresh from the HTTP cache, revalidated with 304 Not Modified or stored after a full download.",
+		}, []string{"result"}),
+		rateLimitWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "adidas_crawler_rate_limit_wait_seconds",
+			Help:    "Time requests waited for the per-host rate limiter.",
+			Buckets: []float64{0, 0.5, 1, 2, 3, 5, 10},
+		}, []string{"host"}),
+		products: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_products_total",
+			Help: "Products fetched, by result.",
+		}, []string{"result"}),
+		parseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "adidas_crawler_parse_failures_total",
+			Help: "Product responses that could not be parsed.",
+		}),
+		schemaDrift: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_schema_drift_total",
+			Help: "Product responses with a field that is missing, null or of another type than expected.",
+		}, []string{"field", "problem"}),
+		productsWritten: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_products_written_total",
+			Help: "Products handed to each output.",
+		}, []string{"sink"}),
+		sinkErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_sink_errors_total",
+			Help: "Products an output failed to write.",
+		}, []string{"sink"}),
+		proxyUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adidas_crawler_proxy_up",
+			Help: "Whether a proxy is in rotation (1) or ejected (0).",
+		}, []string{"proxy"}),
+		proxyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_proxy_requests_total",
+			Help: "Requests sent through each proxy, by result.",
+		}, []string{"proxy", "result"}),
+		proxyEjections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adidas_crawler_proxy_ejections_total",
+			Help: "Times each proxy was ejected from rotation.",
+		}, []string{"proxy"}),
+	}
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.responseBytes, m.retries, m.challenges, m.robotsBlocked, m.httpCache,
+		m.rateLimitWait, m.products, m.parseFailures, m.schemaDrift, m.productsWritten, m.sinkErrors,
+		m.proxyUp, m.proxyRequests, m.proxyEjections,
+	)
+	return m
+}
+
+// metrics is updated by the session, sinks and proxy pool of the running
+// command.
+var metrics = newCrawlerMetrics()
+
+// observeResponse counts a response to a request for dest, or a network
+// error when resp is nil.
+func (m *crawlerMetrics) observeResponse(dest string, resp *http.Response, duration time.Duration) {
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	m.requests.WithLabelValues(dest, status).Inc()
+	m.requestDuration.WithLabelValues(dest).Observe(duration.Seconds())
+}
+
+// serveMetrics serves /metrics on addr until the returned server is closed.
+func serveMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+	return srv, nil
+}
+
+// countingBody adds the bytes read from a response body to a counter.
+type countingBody struct {
+	io.ReadCloser
+	counter prometheus.Counter
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.counter.Add(float64(n))
+	return n, err
+}
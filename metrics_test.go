@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// TestCrawlMetrics crawls the mock with a rate-limited and a malformed
+// product and checks the counters exposed on /metrics.
+func TestCrawlMetrics(t *testing.T) {
+	saved := metrics
+	metrics = newCrawlerMetrics()
+	defer func() { metrics = saved }()
+
+	m := newMockAdidas(t)
+	m.encoding = "gzip"
+	m.fail("/api/products/IA4845", rateLimited("1"))
+	m.fail("/api/products/KB5435", malformedJSON())
+	session, _ := newMockSession(m, 5*time.Second)
+
+	written, failed := crawlProducts(session, []string{"IA4845", "KB5435"}, []ProductSink{&memorySink{}}, nil)
+	if written != 1 || len(failed) != 1 {
+		t.Fatalf("written %d, failed %v", written, failed)
+	}
+
+	server := httptest.NewServer(promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	exposition := string(body)
+
+	for _, want := range []string{
+		`adidas_crawler_http_requests_total{dest="empty",status="200"} 2`,
+		`adidas_crawler_http_requests_total{dest="empty",status="429"} 1`,
+		`adidas_crawler_http_retries_total{reason="429"} 1`,
+		`adidas_crawler_parse_failures_total 1`,
+		`adidas_crawler_products_total{result="failed"} 1`,
+		`adidas_crawler_products_total{result="ok"} 1`,
+		`adidas_crawler_products_written_total{sink="memory"} 1`,
+		`adidas_crawler_rate_limit_wait_seconds_count{host="` + strings.TrimPrefix(m.URL(), "http://") + `"} 3`,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if !strings.Contains(exposition, `adidas_crawler_http_response_bytes_total{dest="empty"}`) {
+		t.Error("metrics lack downloaded bytes")
+	}
+}
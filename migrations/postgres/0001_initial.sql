@@ -0,0 +1,46 @@
+CREATE TABLE crawl_runs (
+    id               BIGSERIAL PRIMARY KEY,
+    started_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at      TIMESTAMPTZ,
+    status           TEXT NOT NULL DEFAULT 'running',
+    hostname         TEXT NOT NULL DEFAULT '',
+    args             TEXT[] NOT NULL DEFAULT '{}',
+    products_written INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE products (
+    id                TEXT PRIMARY KEY,
+    url               TEXT NOT NULL,
+    name              TEXT NOT NULL,
+    price             TEXT NOT NULL,
+    description       TEXT NOT NULL,
+    images            TEXT[] NOT NULL DEFAULT '{}',
+    sizes             TEXT[] NOT NULL DEFAULT '{}',
+    colors            TEXT[] NOT NULL DEFAULT '{}',
+    availability      TEXT NOT NULL,
+    brand             TEXT NOT NULL,
+    category          TEXT NOT NULL,
+    features          TEXT[] NOT NULL DEFAULT '{}',
+    rating_fitting    TEXT NOT NULL,
+    rating_length     TEXT NOT NULL,
+    rating_quality    TEXT NOT NULL,
+    rating_comfort    TEXT NOT NULL,
+    average_rating    TEXT NOT NULL,
+    review_count      TEXT NOT NULL,
+    first_seen_run_id BIGINT NOT NULL REFERENCES crawl_runs (id),
+    last_seen_run_id  BIGINT NOT NULL REFERENCES crawl_runs (id),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One row per product written in a run, so price and stock history can be
+-- reconstructed without keeping every products row version.
+CREATE TABLE run_products (
+    run_id       BIGINT NOT NULL REFERENCES crawl_runs (id) ON DELETE CASCADE,
+    product_id   TEXT NOT NULL,
+    price        TEXT NOT NULL,
+    availability TEXT NOT NULL,
+    written_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (run_id, product_id)
+);
+
+CREATE INDEX run_products_product_id_idx ON run_products (product_id);
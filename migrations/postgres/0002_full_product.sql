@@ -0,0 +1,33 @@
+-- Columns for the product API fields beyond the original output columns.
+-- Structured fields are stored as JSON as the API sends them; extra holds
+-- the fields the crawler does not model, keyed by their JSON path.
+ALTER TABLE products
+    ADD COLUMN model_number          TEXT NOT NULL DEFAULT '',
+    ADD COLUMN product_type          TEXT NOT NULL DEFAULT '',
+    ADD COLUMN sub_brand             TEXT NOT NULL DEFAULT '',
+    ADD COLUMN subtitle              TEXT NOT NULL DEFAULT '',
+    ADD COLUMN gender                TEXT NOT NULL DEFAULT '',
+    ADD COLUMN sports                TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN product_types         TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN current_price         NUMERIC,
+    ADD COLUMN standard_price        NUMERIC,
+    ADD COLUMN standard_price_no_vat NUMERIC,
+    ADD COLUMN on_sale               BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN outlet                BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN orderable             BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN preview_end           TEXT NOT NULL DEFAULT '',
+    ADD COLUMN badge_text            TEXT NOT NULL DEFAULT '',
+    ADD COLUMN badge_style           TEXT NOT NULL DEFAULT '',
+    ADD COLUMN search_color          TEXT NOT NULL DEFAULT '',
+    ADD COLUMN size_chart_url        TEXT NOT NULL DEFAULT '',
+    ADD COLUMN sustainability        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN breadcrumbs           JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN care_instructions     JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN variations            JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN color_variations      JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN gallery_images        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN meta_title            TEXT NOT NULL DEFAULT '',
+    ADD COLUMN meta_description      TEXT NOT NULL DEFAULT '',
+    ADD COLUMN meta_keywords         TEXT NOT NULL DEFAULT '',
+    ADD COLUMN canonical_url         TEXT NOT NULL DEFAULT '',
+    ADD COLUMN extra                 JSONB NOT NULL DEFAULT '{}';
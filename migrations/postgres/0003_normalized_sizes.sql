@@ -0,0 +1,4 @@
+-- Sizes parsed into kind, system and canonical value, with footwear
+-- conversions; see parseSize.
+ALTER TABLE products
+    ADD COLUMN normalized_sizes JSONB NOT NULL DEFAULT '[]';
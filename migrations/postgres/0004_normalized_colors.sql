@@ -0,0 +1,4 @@
+-- Colors mapped onto the canonical palette, with the labels they came from;
+-- see normalizeColors.
+ALTER TABLE products
+    ADD COLUMN normalized_colors JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,9 @@
+-- The attribute lists that make up features, kept apart, and what
+-- -classify-features extracts from the product texts.
+ALTER TABLE products
+    ADD COLUMN functions        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN fit              TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN materials        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN usps             TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN material_content JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN technologies     TEXT[] NOT NULL DEFAULT '{}';
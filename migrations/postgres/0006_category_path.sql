@@ -0,0 +1,5 @@
+-- Category names from the gender down, e.g. {メンズ,ウェア・服,Tシャツ}.
+ALTER TABLE products
+    ADD COLUMN category_path TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX products_category_path_idx ON products USING GIN (category_path);
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// mockFailure is one injected misbehaviour of the mock adidas server. Each
+// failure queued for a path answers exactly one request; once the queue is
+// empty the path is served normally.
+type mockFailure struct {
+	status     int
+	retryAfter string        // Retry-After header sent with the status
+	body       []byte        // replaces the fixture body
+	delay      time.Duration // sleep before answering
+}
+
+func rateLimited(retryAfter string) mockFailure {
+	return mockFailure{status: http.StatusTooManyRequests, retryAfter: retryAfter, body: []byte("Too Many Requests")}
+}
+
+// botChallenge answers with the saved Akamai "Access Denied" page.
+func (m *mockAdidas) botChallenge() mockFailure {
+	body, err := os.ReadFile(filepath.Join(m.root, "testdata", "challenges", "akamai_access_denied.html"))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return mockFailure{status: http.StatusForbidden, body: body}
+}
+
+func malformedJSON() mockFailure {
+	return mockFailure{status: http.StatusOK, body: []byte(`{"id":"IA4845","name":`)}
+}
+
+func slowResponse(delay time.Duration) mockFailure {
+	return mockFailure{delay: delay}
+}
+
+// mockAdidas is a local stand-in for www.adidas.jp. It serves
+// /api/products/{id} from testdata/products/{id}.json, category listings
+// from the saved response_page_*.html files and /robots.txt and /sitemaps/*
+// from testdata/sitemaps, with optional compression and per-path failures.
+// Product responses carry an ETag and answer If-None-Match with 304.
+type mockAdidas struct {
+	t        *testing.T
+	root     string // repository root the fixtures are read from
+	server   *httptest.Server
+	encoding string // "", "gzip" or "br"
+
+	mu         sync.Mutex
+	categories map[string]string // path -> saved listing page
+	failures   map[string][]mockFailure
+	requests   map[string]int
+	cookies    map[string][]string // path -> Cookie header of each request
+}
+
+func newMockAdidas(t *testing.T) *mockAdidas {
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockAdidas{
+		t:    t,
+		root: root,
+		categories: map[string]string{
+			"/メンズ-tシャツ":  "response_page_1750670934070873277.html",
+			"/メンズ-ポロシャツ": "response_page_1750670937220652501.html",
+			"/メンズ-ジャージ":  "response_page_1750670941358572634.html",
+		},
+		failures: make(map[string][]mockFailure),
+		requests: make(map[string]int),
+		cookies:  make(map[string][]string),
+	}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockAdidas) URL() string { return m.server.URL }
+
+// fail queues failures for path, answered in order before normal responses.
+func (m *mockAdidas) fail(path string, failures ...mockFailure) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[path] = append(m.failures[path], failures...)
+}
+
+// requestCount returns how many requests reached path.
+func (m *mockAdidas) requestCount(path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests[path]
+}
+
+// cookieHeaders returns the Cookie header sent with each request to path.
+func (m *mockAdidas) cookieHeaders(path string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.cookies[path]...)
+}
+
+func (m *mockAdidas) serve(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.requests[r.URL.Path]++
+	m.cookies[r.URL.Path] = append(m.cookies[r.URL.Path], r.Header.Get("Cookie"))
+	var failure *mockFailure
+	if queue := m.failures[r.URL.Path]; len(queue) > 0 {
+		failure = &queue[0]
+		m.failures[r.URL.Path] = queue[1:]
+	}
+	m.mu.Unlock()
+
+	if failure != nil && failure.delay > 0 {
+		select {
+		case <-time.After(failure.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if r.URL.Path == "/" {
+		// The home page hands out the cookies a first visit gets.
+		http.SetCookie(w, &http.Cookie{Name: "geo_ctry", Value: "JP", Path: "/", MaxAge: 86400})
+		http.SetCookie(w, &http.Cookie{Name: "bm_sz", Value: "warm", Path: "/", HttpOnly: true})
+	}
+	status, contentType, body := m.response(r)
+	if failure != nil && failure.status != 0 {
+		status, body = failure.status, failure.body
+		if status != http.StatusOK {
+			contentType = "text/html; charset=utf-8"
+		}
+		if failure.retryAfter != "" {
+			w.Header().Set("Retry-After", failure.retryAfter)
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	if strings.HasPrefix(r.URL.Path, "/api/products/") && status == http.StatusOK {
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	m.write(w, status, body)
+}
+
+func (m *mockAdidas) response(r *http.Request) (int, string, []byte) {
+	if id, ok := strings.CutPrefix(r.URL.Path, "/api/products/"); ok {
+		body, err := os.ReadFile(filepath.Join(m.root, "testdata", "products", id+".json"))
+		if err != nil {
+			return http.StatusNotFound, "application/json", []byte(`{"message":"product not found"}`)
+		}
+		return http.StatusOK, "application/json", body
+	}
+
+	if r.URL.Path == "/" {
+		return http.StatusOK, "text/html; charset=utf-8", []byte("<html><head><title>adidas</title></head><body></body></html>")
+	}
+
+	if name, ok := strings.CutPrefix(r.URL.Path, "/sitemaps/"); ok || r.URL.Path == "/robots.txt" {
+		if !ok {
+			name = "robots.txt"
+		}
+		body, err := os.ReadFile(filepath.Join(m.root, "testdata", "sitemaps", name))
+		if err != nil {
+			return http.StatusNotFound, "text/plain", []byte("Not Found")
+		}
+		if strings.HasSuffix(name, ".gz") {
+			return http.StatusOK, "application/x-gzip", body
+		}
+		// Point the sitemap links at the mock.
+		return http.StatusOK, "application/xml", bytes.ReplaceAll(body, []byte("https://www.adidas.jp"), []byte(m.URL()))
+	}
+
+	page, ok := m.categories[r.URL.Path]
+	if !ok {
+		return http.StatusNotFound, "text/html; charset=utf-8", []byte("<html><body>Not Found</body></html>")
+	}
+	if start := r.URL.Query().Get("start"); start != "" && start != "0" {
+		// Only the first listing page was saved; later pages are empty.
+		return http.StatusOK, "text/html; charset=utf-8", []byte("<html><body></body></html>")
+	}
+	body, err := os.ReadFile(filepath.Join(m.root, page))
+	if err != nil {
+		m.t.Errorf("mock adidas: %v", err)
+		return http.StatusInternalServerError, "text/plain", nil
+	}
+	return http.StatusOK, "text/html; charset=utf-8", body
+}
+
+func (m *mockAdidas) write(w http.ResponseWriter, status int, body []byte) {
+	var buf bytes.Buffer
+	switch m.encoding {
+	case "gzip":
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+	case "br":
+		bw := brotli.NewWriter(&buf)
+		bw.Write(body)
+		bw.Close()
+	default:
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Encoding", m.encoding)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// newMockSession returns a session pointed at the mock server that neither
+// rate limits nor really sleeps; the requested sleeps are recorded instead.
+// Failed responses go to an error store in a temporary directory.
+func newMockSession(m *mockAdidas, timeout time.Duration) (*ScrapingSession, *[]time.Duration) {
+	session := NewScrapingSession(SessionOptions{BaseURL: m.URL(), Timeout: timeout})
+	session.limiter = newRateLimiter(0, 0)
+	session.errors = newErrorStore(filepath.Join(m.t.TempDir(), "errors"))
+	var sleeps []time.Duration
+	session.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	return session, &sleeps
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is the advisory lock key held while migrating, so two
+// crawlers starting against the same database do not race.
+const postgresMigrationLock = 7346110421
+
+// PostgresOptions configures the Postgres output backend.
+type PostgresOptions struct {
+	DSN       string
+	Schema    string // created if missing; empty uses the connection's search_path
+	BatchSize int
+}
+
+type postgresMigration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadPostgresMigrations() ([]postgresMigration, error) {
+	dir := "migrations/postgres"
+	entries, err := fs.ReadDir(postgresMigrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %v", err)
+	}
+	var migrations []postgresMigration
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has invalid version: %v", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(postgresMigrations, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", entry.Name(), err)
+		}
+		migrations = append(migrations, postgresMigration{version: version, name: entry.Name(), sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// migratePostgres applies every embedded migration that is not yet recorded in
+// schema_migrations and returns how many were applied.
+func migratePostgres(ctx context.Context, conn *pgx.Conn) (int, error) {
+	migrations, err := loadPostgresMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLock); err != nil {
+		return 0, fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", postgresMigrationLock)
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	applied, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	done := make(map[int]bool)
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if done[m.version] {
+			continue
+		}
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return count, err
+		}
+		if _, err := tx.Exec(ctx, m.sql); err != nil {
+			tx.Rollback(ctx)
+			return count, fmt.Errorf("migration %s failed: %v", m.name, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+			tx.Rollback(ctx)
+			return count, fmt.Errorf("failed to record migration %s: %v", m.name, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return count, fmt.Errorf("failed to commit migration %s: %v", m.name, err)
+		}
+		slog.Info("Applied Postgres migration", "migration", m.name)
+		count++
+	}
+	return count, nil
+}
+
+// postgresProductColumns lists the products columns filled from ProductData,
+// in the order used by postgresProductRow.
+var postgresProductColumns = []string{
+	"id", "url", "name", "price", "description", "images", "sizes", "colors",
+	"availability", "brand", "category", "features", "rating_fitting",
+	"rating_length", "rating_quality", "rating_comfort", "average_rating",
+	"review_count", "first_seen_run_id", "last_seen_run_id",
+	"model_number", "product_type", "sub_brand", "subtitle", "gender", "sports",
+	"product_types", "current_price", "standard_price", "standard_price_no_vat",
+	"on_sale", "outlet", "orderable", "preview_end", "badge_text", "badge_style",
+	"search_color", "size_chart_url", "sustainability", "breadcrumbs",
+	"care_instructions", "variations", "color_variations", "gallery_images",
+	"meta_title", "meta_description", "meta_keywords", "canonical_url", "extra",
+	"normalized_sizes", "normalized_colors", "functions", "fit", "materials", "usps",
+	"material_content", "technologies", "category_path",
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// postgresJSON encodes a JSONB column, using empty for nil or empty values.
+func postgresJSON(v any, empty string) json.RawMessage {
+	if encoded := encodeStructured(v); encoded != "" {
+		return json.RawMessage(encoded)
+	}
+	return json.RawMessage(empty)
+}
+
+func postgresProductRow(p *ProductData, runID int64) []any {
+	return []any{
+		p.ID, p.URL, p.Name, p.Price, p.Description, nonNil(p.Images), nonNil(p.Sizes), nonNil(p.Colors),
+		p.Availability, p.Brand, p.Category, nonNil(p.Features), p.RatingFitting,
+		p.RatingLength, p.RatingQuality, p.RatingComfort, p.AverageRating,
+		p.ReviewCount, runID, runID,
+		p.ModelNumber, p.ProductType, p.SubBrand, p.Subtitle, p.Gender, nonNil(p.Sports),
+		nonNil(p.ProductTypes), p.CurrentPrice, p.StandardPrice, p.StandardPriceNoVAT,
+		p.OnSale, p.Outlet, p.Orderable, p.PreviewEnd, p.BadgeText, p.BadgeStyle,
+		p.SearchColor, p.SizeChartURL, nonNil(p.Sustainability), postgresJSON(p.Breadcrumbs, "[]"),
+		postgresJSON(p.CareInstructions, "[]"), postgresJSON(p.Variations, "[]"), postgresJSON(p.ColorVariations, "[]"), nonNil(p.GalleryImages),
+		p.MetaTitle, p.MetaDescription, p.MetaKeywords, p.CanonicalURL, postgresJSON(p.Extra, "{}"),
+		postgresJSON(p.NormalizedSizes, "[]"), postgresJSON(p.NormalizedColors, "[]"), nonNil(p.Functions), nonNil(p.Fit), nonNil(p.Materials), nonNil(p.USPs),
+		postgresJSON(p.MaterialContent, "[]"), nonNil(p.Technologies), nonNil(p.CategoryPath),
+	}
+}
+
+// postgresSink buffers products and writes them in batches: each batch is
+// COPYed into a temporary staging table and upserted into products from there.
+type postgresSink struct {
+	conn      *pgx.Conn
+	opts      PostgresOptions
+	runID     int64
+	pending   []*ProductData
+	failed    bool
+	upsertSQL string
+}
+
+// postgresLocation describes the database of opts without its credentials.
+func postgresLocation(opts PostgresOptions) string {
+	config, err := pgx.ParseConfig(opts.DSN)
+	if err != nil {
+		return "postgres"
+	}
+	location := fmt.Sprintf("postgres://%s:%d/%s", config.Host, config.Port, config.Database)
+	if opts.Schema != "" {
+		location += " (schema " + opts.Schema + ")"
+	}
+	return location
+}
+
+func newPostgresSink(opts PostgresOptions) (*postgresSink, error) {
+	ctx := context.Background()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+
+	config, err := pgx.ParseConfig(opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Postgres DSN: %v", err)
+	}
+	if opts.Schema != "" {
+		config.RuntimeParams["search_path"] = opts.Schema
+	}
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Postgres: %v", err)
+	}
+
+	if opts.Schema != "" {
+		if _, err := conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{opts.Schema}.Sanitize()); err != nil {
+			conn.Close(ctx)
+			return nil, fmt.Errorf("failed to create schema %s: %v", opts.Schema, err)
+		}
+	}
+
+	if _, err := migratePostgres(ctx, conn); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	var runID int64
+	err = conn.QueryRow(ctx,
+		"INSERT INTO crawl_runs (hostname, args) VALUES ($1, $2) RETURNING id",
+		hostname, os.Args[1:]).Scan(&runID)
+	if err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("failed to record crawl run: %v", err)
+	}
+	slog.Info("Started Postgres crawl run", "run_id", runID)
+
+	return &postgresSink{
+		conn:      conn,
+		opts:      opts,
+		runID:     runID,
+		upsertSQL: buildPostgresUpsert(),
+	}, nil
+}
+
+func buildPostgresUpsert() string {
+	var updates []string
+	for _, col := range postgresProductColumns {
+		if col == "id" || col == "first_seen_run_id" {
+			continue
+		}
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+	}
+	updates = append(updates, "updated_at = now()")
+	columns := strings.Join(postgresProductColumns, ", ")
+	return fmt.Sprintf("INSERT INTO products (%s) SELECT %s FROM products_stage ON CONFLICT (id) DO UPDATE SET %s",
+		columns, columns, strings.Join(updates, ", "))
+}
+
+func (s *postgresSink) Name() string { return "postgres" }
+
+func (s *postgresSink) WriteProduct(p *ProductData) error {
+	s.pending = append(s.pending, p)
+	if len(s.pending) < s.opts.BatchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *postgresSink) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+
+	// ON CONFLICT cannot touch the same row twice in one statement, so keep
+	// only the latest copy of each product in the batch.
+	latest := make(map[string]int)
+	for i, p := range s.pending {
+		latest[p.ID] = i
+	}
+	var rows [][]any
+	for i, p := range s.pending {
+		if latest[p.ID] == i {
+			rows = append(rows, postgresProductRow(p, s.runID))
+		}
+	}
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to begin Postgres batch: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "CREATE TEMP TABLE products_stage (LIKE products INCLUDING DEFAULTS) ON COMMIT DROP"); err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to create staging table: %v", err)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"products_stage"}, postgresProductColumns, pgx.CopyFromRows(rows)); err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to copy %d products: %v", len(rows), err)
+	}
+	if _, err := tx.Exec(ctx, s.upsertSQL); err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to upsert products: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO run_products (run_id, product_id, price, availability)
+		SELECT $1, id, price, availability FROM products_stage
+		ON CONFLICT (run_id, product_id) DO UPDATE
+		SET price = EXCLUDED.price, availability = EXCLUDED.availability, written_at = now()`, s.runID); err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to record run products: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE crawl_runs
+		SET products_written = (SELECT count(*) FROM run_products WHERE run_id = $1)
+		WHERE id = $1`, s.runID); err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to update crawl run: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		s.failed = true
+		return fmt.Errorf("failed to commit Postgres batch: %v", err)
+	}
+
+	slog.Debug("Wrote products to Postgres", "run_id", s.runID, "products", len(rows))
+	s.pending = s.pending[:0]
+	return nil
+}
+
+func (s *postgresSink) Close() error {
+	ctx := context.Background()
+	flushErr := s.flush()
+
+	status := "completed"
+	if s.failed {
+		status = "failed"
+	}
+	if _, err := s.conn.Exec(ctx,
+		"UPDATE crawl_runs SET finished_at = now(), status = $2 WHERE id = $1",
+		s.runID, status); err != nil {
+		slog.Error("Failed to finish Postgres crawl run", "run_id", s.runID, "error", err)
+	}
+	if err := s.conn.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close Postgres connection: %v", err)
+	}
+	slog.Info("Closed Postgres crawl run", "run_id", s.runID, "status", status)
+	return flushErr
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// productResponse models the /api/products/{id} response. Fields it does not
+// declare end up in ProductData.Extra.
+type productResponse struct {
+	ID                     string             `json:"id"`
+	ProductType            string             `json:"product_type"`
+	ModelNumber            string             `json:"model_number"`
+	Name                   string             `json:"name"`
+	MetaData               productMetaData    `json:"meta_data"`
+	ViewList               []productAsset     `json:"view_list"`
+	ProductListingAssets   []productAsset     `json:"product_listing_assets"`
+	PricingInformation     productPricing     `json:"pricing_information"`
+	AttributeList          productAttributes  `json:"attribute_list"`
+	BreadcrumbList         []Breadcrumb       `json:"breadcrumb_list"`
+	ProductDescription     productDescription `json:"product_description"`
+	VariationList          []Variation        `json:"variation_list"`
+	ProductLinkList        []productLink      `json:"product_link_list"`
+	RecommendationsEnabled bool               `json:"recommendationsEnabled"`
+}
+
+type productMetaData struct {
+	PageTitle   string `json:"page_title"`
+	SiteName    string `json:"site_name"`
+	Description string `json:"description"`
+	Keywords    string `json:"keywords"`
+	Canonical   string `json:"canonical"`
+}
+
+type productAsset struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	Source   string `json:"source"`
+}
+
+type productPricing struct {
+	CurrentPrice       float64 `json:"currentPrice"`
+	StandardPrice      float64 `json:"standard_price"`
+	StandardPriceNoVAT float64 `json:"standard_price_no_vat"`
+}
+
+type productAttributes struct {
+	Brand           string   `json:"brand"`
+	Color           string   `json:"color"`
+	Gender          string   `json:"gender"`
+	Category        string   `json:"category"`
+	Sport           []string `json:"sport"`
+	ProductType     []string `json:"productType"`
+	ProductFit      []string `json:"productfit"`
+	BaseMaterial    []string `json:"base_material"`
+	Functions       []string `json:"functions"`
+	IsOrderable     bool     `json:"is_orderable"`
+	IsCnCRestricted bool     `json:"isCnCRestricted"`
+	SearchColor     string   `json:"search_color"`
+	SizeChartLink   string   `json:"size_chart_link"`
+	PreviewTo       string   `json:"preview_to"` // end of the preview window of upcoming products
+	BadgeText       string   `json:"badge_text"`
+	BadgeStyle      string   `json:"badge_style"`
+	Sale            bool     `json:"sale"`
+	Outlet          bool     `json:"outlet"`
+	Sustainability  []string `json:"sustainability"`
+}
+
+type productDescription struct {
+	Title                string   `json:"title"`
+	Subtitle             string   `json:"subtitle"`
+	Text                 string   `json:"text"`
+	Usps                 []string `json:"usps"`
+	WashCareInstructions struct {
+		CareInstructions []CareInstruction `json:"care_instructions"`
+	} `json:"wash_care_instructions"`
+}
+
+type productLink struct {
+	ProductID    string `json:"productId"`
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	DefaultColor string `json:"default_color"`
+	SearchColor  string `json:"search_color"`
+	Type         string `json:"type"`
+}
+
+// Breadcrumb is one level of the category path shown above a product.
+type Breadcrumb struct {
+	Text string `json:"text"`
+	Link string `json:"link"`
+}
+
+// CareInstruction is a washing or care symbol with its description.
+type CareInstruction struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// Variation is one orderable size of a product.
+type Variation struct {
+	SKU  string `json:"sku"`
+	Size string `json:"size"`
+}
+
+// ColorVariation links to the same model in another color.
+type ColorVariation struct {
+	ID           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	URL          string `json:"url"`
+	DefaultColor string `json:"default_color"`
+	SearchColor  string `json:"search_color"`
+}
+
+// unmodeledFields returns the fields of a product response that
+// productResponse does not declare, keyed by their dotted path, e.g.
+// "attribute_list.specialLaunch". Objects the model declares are searched
+// for unknown keys; arrays are kept or dropped as a whole.
+func unmodeledFields(body []byte) map[string]any {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var root map[string]any
+	if err := dec.Decode(&root); err != nil {
+		return nil
+	}
+	extra := make(map[string]any)
+	collectUnmodeled(root, reflect.TypeOf(productResponse{}), "", extra)
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
+func collectUnmodeled(obj map[string]any, t reflect.Type, prefix string, extra map[string]any) {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		fields[name] = f.Type
+	}
+	for key, value := range obj {
+		ft, ok := fields[key]
+		if !ok {
+			extra[prefix+key] = value
+			continue
+		}
+		if child, isObj := value.(map[string]any); isObj && ft.Kind() == reflect.Struct {
+			collectUnmodeled(child, ft, prefix+key+".", extra)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseProductFullModel(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "products", "KB5435.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseProduct("KB5435", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ModelNumber != "NKY42" || p.SubBrand != "Originals" || p.Gender != "M" || p.Subtitle != "GOALIE TOP" {
+		t.Errorf("attributes = %q %q %q %q", p.ModelNumber, p.SubBrand, p.Gender, p.Subtitle)
+	}
+	if p.CurrentPrice != 7370 || p.StandardPrice != 9900 || !p.OnSale || p.Outlet || p.BadgeText != "セール" {
+		t.Errorf("pricing = %v %v %v %v %q", p.CurrentPrice, p.StandardPrice, p.OnSale, p.Outlet, p.BadgeText)
+	}
+	if len(p.Sports) != 2 || len(p.Breadcrumbs) != 3 || p.Breadcrumbs[0].Text != "メンズ" ||
+		len(p.Variations) != 10 || p.Variations[0].SKU != "KB5435_530" ||
+		len(p.ColorVariations) != 4 || p.ColorVariations[0].ID != "KB5436" || len(p.GalleryImages) != 2 {
+		t.Errorf("lists = %+v", p)
+	}
+	if p.Extra != nil {
+		t.Errorf("fully modeled response has extra fields %v", p.Extra)
+	}
+
+	// Fields the model does not know are passed through by JSON path.
+	var raw map[string]any
+	json.Unmarshal(body, &raw)
+	raw["release_info"] = map[string]any{"launch": "2025-07-01"}
+	raw["attribute_list"].(map[string]any)["specialLaunch"] = true
+	raw["pricing_information"].(map[string]any)["discount_text"] = "25% OFF"
+	body, _ = json.Marshal(raw)
+	if p, err = parseProduct("KB5435", body); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Extra) != 3 || p.Extra["attribute_list.specialLaunch"] != true || p.Extra["pricing_information.discount_text"] != "25% OFF" {
+		t.Errorf("extra = %v", p.Extra)
+	}
+	if launch, _ := p.Extra["release_info"].(map[string]any); launch["launch"] != "2025-07-01" {
+		t.Errorf("extra release_info = %v", p.Extra["release_info"])
+	}
+}
+
+// TestExcelUpgradesV3Sheet opens a sheet written before the full product
+// model and checks that its rows move to the current columns.
+func TestExcelUpgradesV3Sheet(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "products.xlsx")
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Products")
+	old := csvSchemaHistory[3]
+	for col, header := range old {
+		cell, _ := excelize.CoordinatesToCellName(col+1, 1)
+		f.SetCellValue("Products", cell, header)
+	}
+	row := make([]string, len(old))
+	row[0], row[3], row[len(old)-1] = "IA4845", "4400 JPY", "2"
+	for col, value := range row {
+		cell, _ := excelize.CoordinatesToCellName(col+1, 2)
+		f.SetCellValue("Products", cell, value)
+	}
+	if err := f.SaveAs(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := newExcelSink(filename, ModeUpsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.WriteProduct(testProduct("IA4846", "3500 JPY")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = excelize.OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, _ := f.GetRows("Products")
+	if len(rows) != 3 || !equalHeaders(rows[0], outputHeaders()) {
+		t.Fatalf("header = %q, %d rows", rows[0], len(rows))
+	}
+	if rows[1][0] != "IA4845" || rows[1][3] != "4400 JPY" || rows[1][len(productColumns)] != "2" {
+		t.Errorf("upgraded row = %q", rows[1])
+	}
+	if rows[2][0] != "IA4846" {
+		t.Errorf("new row = %q", rows[2])
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Proxy rotation strategies.
+const (
+	proxyRoundRobin    = "round-robin"
+	proxySticky        = "sticky"
+	proxyLeastFailures = "least-failures"
+)
+
+// ProxyOptions configures a proxy pool. Proxies are given as URLs with an
+// http, https or socks5 scheme; a bare host:port is treated as http.
+type ProxyOptions struct {
+	URLs           []string
+	File           string        // one proxy per line, # starts a comment
+	Strategy       string        // round-robin (default), sticky or least-failures
+	MaxFailures    int           // consecutive 403/429/network failures before ejection
+	HealthURL      string        // fetched through every proxy by health checks
+	HealthInterval time.Duration // 0 disables periodic health checks
+	HealthTimeout  time.Duration
+	Identity       *browserIdentity // headers health checks are sent with; nil sends none
+	// TrialAfter is the number of health checks in a row an ejected proxy
+	// must answer with 403 or 429 before it is put back for a trial.
+	TrialAfter int
+}
+
+// proxyStats counts what happened to the requests sent through one proxy.
+type proxyStats struct {
+	Proxy       string
+	Requests    int
+	Successes   int
+	Blocked     int // 403 and 429 responses
+	Errors      int // network errors
+	Ejections   int
+	Ejected     bool
+	LastError   string
+	LastLatency time.Duration
+}
+
+type proxyEntry struct {
+	url       *url.URL
+	transport *http.Transport // one per proxy so connections are pooled per proxy
+	stats     proxyStats      // Proxy holds the URL with the password redacted
+	// consecutive failures since the last success; reaching
+	// ProxyOptions.MaxFailures ejects the proxy.
+	consecutive int
+	// blockedChecks counts the health checks in a row answered with 403
+	// or 429 while the proxy is ejected.
+	blockedChecks int
+}
+
+// proxyPool is an http.RoundTripper that sends every request through one of
+// its proxies. Proxies answering with 403 or 429, or failing to connect,
+// MaxFailures times in a row are ejected until a health check finds them
+// working again or puts them back for a trial, see checkHealth.
+type proxyPool struct {
+	mu       sync.Mutex
+	opts     ProxyOptions
+	proxies  []*proxyEntry
+	next     int
+	sticky   *proxyEntry
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newProxyPool(opts ProxyOptions) (*proxyPool, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = proxyRoundRobin
+	}
+	switch opts.Strategy {
+	case proxyRoundRobin, proxySticky, proxyLeastFailures:
+	default:
+		return nil, fmt.Errorf("unknown proxy strategy %q (want round-robin, sticky or least-failures)", opts.Strategy)
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 3
+	}
+	if opts.HealthTimeout == 0 {
+		opts.HealthTimeout = 15 * time.Second
+	}
+	if opts.TrialAfter <= 0 {
+		opts.TrialAfter = 3
+	}
+
+	raw := opts.URLs
+	if opts.File != "" {
+		fromFile, err := loadProxyList(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, fromFile...)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("no proxies configured")
+	}
+
+	p := &proxyPool{opts: opts, stop: make(chan struct{})}
+	for _, r := range raw {
+		u, err := parseProxyURL(r)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(u)
+		p.proxies = append(p.proxies, &proxyEntry{
+			url:       u,
+			transport: transport,
+			stats:     proxyStats{Proxy: u.Redacted()},
+		})
+		metrics.proxyUp.WithLabelValues(u.Redacted()).Set(1)
+	}
+
+	if opts.HealthInterval > 0 && opts.HealthURL != "" {
+		go p.healthLoop()
+	}
+	return p, nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %v", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %s has unsupported scheme %q (want http, https or socks5)", u.Redacted(), u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %s has no host", raw)
+	}
+	return u, nil
+}
+
+func loadProxyList(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy file: %v", err)
+	}
+	var proxies []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			proxies = append(proxies, line)
+		}
+	}
+	return proxies, nil
+}
+
+// pick returns the proxy for the next request, or nil when every proxy has
+// been ejected.
+func (p *proxyPool) pick() *proxyEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.opts.Strategy {
+	case proxySticky:
+		if p.sticky != nil && !p.sticky.stats.Ejected {
+			return p.sticky
+		}
+		p.sticky = p.nextHealthy()
+		return p.sticky
+	case proxyLeastFailures:
+		var best *proxyEntry
+		for _, e := range p.proxies {
+			if e.stats.Ejected {
+				continue
+			}
+			if best == nil || e.failures() < best.failures() {
+				best = e
+			}
+		}
+		return best
+	}
+	return p.nextHealthy()
+}
+
+// nextHealthy advances the round-robin cursor to the next proxy that is not
+// ejected. Callers hold p.mu.
+func (p *proxyPool) nextHealthy() *proxyEntry {
+	for range p.proxies {
+		e := p.proxies[p.next%len(p.proxies)]
+		p.next++
+		if !e.stats.Ejected {
+			return e
+		}
+	}
+	return nil
+}
+
+func (e *proxyEntry) failures() int {
+	return e.stats.Blocked + e.stats.Errors
+}
+
+func (p *proxyPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := p.pick()
+	if e == nil {
+		return nil, fmt.Errorf("all %d proxies are ejected", len(p.proxies))
+	}
+	start := time.Now()
+	resp, err := e.transport.RoundTrip(req)
+	p.record(e, resp, err, time.Since(start))
+	return resp, err
+}
+
+// record updates the stats of e with the outcome of one request and ejects
+// it after too many consecutive failures.
+func (p *proxyPool) record(e *proxyEntry, resp *http.Response, err error, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.stats.Requests++
+	e.stats.LastLatency = latency
+	switch {
+	case err != nil:
+		e.stats.Errors++
+		e.stats.LastError = err.Error()
+		metrics.proxyRequests.WithLabelValues(e.stats.Proxy, "error").Inc()
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		e.stats.Blocked++
+		e.stats.LastError = resp.Status
+		metrics.proxyRequests.WithLabelValues(e.stats.Proxy, "blocked").Inc()
+	default:
+		e.stats.Successes++
+		e.consecutive = 0
+		metrics.proxyRequests.WithLabelValues(e.stats.Proxy, "ok").Inc()
+		return
+	}
+
+	e.consecutive++
+	if e.consecutive >= p.opts.MaxFailures && !e.stats.Ejected {
+		e.stats.Ejected = true
+		e.stats.Ejections++
+		e.transport.CloseIdleConnections()
+		metrics.proxyUp.WithLabelValues(e.stats.Proxy).Set(0)
+		metrics.proxyEjections.WithLabelValues(e.stats.Proxy).Inc()
+		slog.Warn("Ejected proxy", "proxy", e.stats.Proxy, "consecutive_failures", e.consecutive, "last_error", e.stats.LastError)
+	}
+}
+
+func (p *proxyPool) healthLoop() {
+	ticker := time.NewTicker(p.opts.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.checkHealth()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// checkHealth fetches HealthURL through every proxy. Proxies that answer
+// with a 2xx or 3xx status are reinstated. A 403 or 429 shows the proxy is
+// reachable but cannot tell a blocked proxy from a blocked site, so it keeps
+// the proxy's state; an ejected proxy answering so TrialAfter times in a row
+// is put back half-open, one failed request away from ejection. Other errors
+// eject the proxy.
+func (p *proxyPool) checkHealth() {
+	for _, e := range p.proxies {
+		client := &http.Client{
+			Transport: e.transport,
+			Timeout:   p.opts.HealthTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		healthy, blocked := false, false
+		reason := ""
+		resp, err := p.healthRequest(client)
+		if err != nil {
+			reason = err.Error()
+		} else {
+			resp.Body.Close()
+			healthy = resp.StatusCode < 400
+			blocked = resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+			reason = resp.Status
+		}
+
+		p.mu.Lock()
+		if !blocked {
+			e.blockedChecks = 0
+		}
+		switch {
+		case blocked && e.stats.Ejected:
+			e.blockedChecks++
+			if e.blockedChecks < p.opts.TrialAfter {
+				slog.Debug("Proxy health check blocked by the site", "proxy", e.stats.Proxy, "status", reason)
+				break
+			}
+			e.stats.Ejected = false
+			e.blockedChecks = 0
+			e.consecutive = p.opts.MaxFailures - 1
+			metrics.proxyUp.WithLabelValues(e.stats.Proxy).Set(1)
+			slog.Info("Proxy still blocked at health checks, reinstated for a trial request", "proxy", e.stats.Proxy, "status", reason)
+		case blocked:
+			// The proxy is reachable; whether the site blocks it is up to
+			// the crawl's own failure counting.
+			slog.Debug("Proxy health check blocked by the site", "proxy", e.stats.Proxy, "status", reason)
+		case healthy && e.stats.Ejected:
+			e.stats.Ejected = false
+			e.consecutive = 0
+			metrics.proxyUp.WithLabelValues(e.stats.Proxy).Set(1)
+			slog.Info("Proxy passed health check, reinstated", "proxy", e.stats.Proxy)
+		case !healthy && !e.stats.Ejected:
+			e.stats.Ejected = true
+			e.stats.Ejections++
+			e.stats.LastError = reason
+			metrics.proxyUp.WithLabelValues(e.stats.Proxy).Set(0)
+			metrics.proxyEjections.WithLabelValues(e.stats.Proxy).Inc()
+			slog.Warn("Proxy failed health check, ejected", "proxy", e.stats.Proxy, "reason", reason)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// healthRequest sends the health check GET with the pool identity's headers,
+// since bot protection answers bare requests with 403.
+func (p *proxyPool) healthRequest(client *http.Client) (*http.Response, error) {
+	req, err := http.NewRequest("GET", p.opts.HealthURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.opts.Identity != nil {
+		p.opts.Identity.apply(req, destDocument, "none", "")
+	}
+	return client.Do(req)
+}
+
+// stats returns a snapshot of the per-proxy counters, busiest first.
+func (p *proxyPool) stats() []proxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]proxyStats, len(p.proxies))
+	for i, e := range p.proxies {
+		stats[i] = e.stats
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Requests > stats[j].Requests })
+	return stats
+}
+
+// Close stops the health checks, drops idle connections and logs the
+// per-proxy stats.
+func (p *proxyPool) Close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	for _, e := range p.proxies {
+		e.transport.CloseIdleConnections()
+	}
+	for _, s := range p.stats() {
+		slog.Info("Proxy stats", "proxy", s.Proxy, "requests", s.Requests, "ok", s.Successes,
+			"blocked", s.Blocked, "errors", s.Errors, "ejections", s.Ejections, "ejected", s.Ejected)
+	}
+	return nil
+}
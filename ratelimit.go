@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out requests to the same host by a minimum interval plus
+// random jitter, so the crawler never hits a host in bursts.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	jitter   time.Duration
+	next     map[string]time.Time
+	min      map[string]time.Duration // per-host floor for interval, e.g. a robots.txt crawl-delay
+}
+
+func newRateLimiter(interval, jitter time.Duration) *rateLimiter {
+	return &rateLimiter{
+		interval: interval,
+		jitter:   jitter,
+		next:     make(map[string]time.Time),
+		min:      make(map[string]time.Duration),
+	}
+}
+
+// setMinInterval makes requests to host at least d apart, even when the
+// limiter's interval is shorter.
+func (l *rateLimiter) setMinInterval(host string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.min[host] = d
+}
+
+// wait blocks until the next request to host is allowed and returns how long
+// it slept.
+func (l *rateLimiter) wait(host string) time.Duration {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	gap := l.interval
+	if gap < l.min[host] {
+		gap = l.min[host]
+	}
+	if l.jitter > 0 {
+		gap += time.Duration(rand.Int63n(int64(l.jitter)))
+	}
+	l.next[host] = at.Add(gap)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	time.Sleep(delay)
+	return delay
+}
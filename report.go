@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the report files written into the run directory.
+const (
+	reportJSONFile = "report.json"
+	reportTextFile = "report.txt"
+)
+
+// runReport summarizes one crawl. It is written to the run directory as
+// report.json and report.txt; the product hashes let the next run tell new,
+// changed and removed products apart.
+type runReport struct {
+	RunID    string `json:"run_id"`
+	Identity string `json:"identity,omitempty"`
+	// RobotsIgnored records a run with -ignore-robots.
+	RobotsIgnored bool          `json:"robots_ignored"`
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Duration      time.Duration `json:"duration_ns"`
+
+	Requested         int     `json:"requested"`
+	Succeeded         int     `json:"succeeded"`
+	Failed            int     `json:"failed"`
+	ProductsPerMinute float64 `json:"products_per_minute"`
+
+	Failures       map[string][]string `json:"failures"`                // error class -> IDs
+	NotAttempted   []string            `json:"not_attempted,omitempty"` // IDs left when schema drift stopped the crawl
+	Retried        map[string]int      `json:"retried"`                 // ID -> retries
+	ErrorResponses int                 `json:"error_responses"`
+	SchemaDrift    []driftStat         `json:"schema_drift,omitempty"`
+	Schedule       *scheduleSummary    `json:"schedule,omitempty"` // set by incremental runs
+
+	PreviousRun string   `json:"previous_run,omitempty"`
+	New         []string `json:"new"`
+	Changed     []string `json:"changed"`
+	Removed     []string `json:"removed"`
+	Unchanged   []string `json:"unchanged"` // answered from the HTTP cache, never counted as changed
+
+	Outputs  map[string]string `json:"outputs"`  // output -> file, directory or database
+	Products map[string]string `json:"products"` // ID -> hash of the parsed product
+}
+
+func newRunReport(runDir string, started time.Time) *runReport {
+	return &runReport{
+		RunID:     filepath.Base(runDir),
+		StartedAt: started,
+		Failures:  make(map[string][]string),
+		Retried:   make(map[string]int),
+		Outputs:   make(map[string]string),
+		Products:  make(map[string]string),
+	}
+}
+
+func (r *runReport) recordSuccess(p *ProductData) {
+	r.Succeeded++
+	r.Products[p.ID] = productHash(p)
+}
+
+func (r *runReport) recordFailure(id string, err error) {
+	r.Failed++
+	class := errorClass(err)
+	r.Failures[class] = append(r.Failures[class], id)
+}
+
+// carryOver copies the hashes of ids from prev, for products an incremental
+// run did not crawl, so they count neither as removed now nor as new later.
+func (r *runReport) carryOver(prev *runReport, ids []string) {
+	for _, id := range ids {
+		if _, ok := r.Products[id]; ok {
+			continue
+		}
+		if hash, ok := prev.product(id); ok {
+			r.Products[id] = hash
+		}
+	}
+}
+
+// productHash identifies the content of a parsed product.
+func productHash(p *ProductData) string {
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// finish fills in the totals and the differences to prev, which may be nil
+// for the first run. Products of prev that were not requested again or are
+// gone from the site count as removed; products that failed for other
+// reasons, such as a block, do not, and keep their previous hash so the next
+// successful run does not report them as new; so do products not attempted. Products the session answered from its
+// HTTP cache (fresh, or 304 Not Modified) are unchanged even when their
+// hash differs, e.g. after a parser change.
+func (r *runReport) finish(session *ScrapingSession, ids []string, prev *runReport, finished time.Time) {
+	r.FinishedAt = finished
+	r.Duration = finished.Sub(r.StartedAt)
+	r.Requested = len(ids)
+	if minutes := r.Duration.Minutes(); minutes > 0 {
+		r.ProductsPerMinute = float64(r.Succeeded) / minutes
+	}
+	if session != nil {
+		r.Identity = session.identity.Name
+		r.SchemaDrift = session.drift.summary()
+		for id, n := range session.retried {
+			r.Retried[id] = n
+		}
+		if session.errors != nil {
+			r.ErrorResponses = session.errors.count
+			if r.ErrorResponses > 0 {
+				r.Outputs["errors"] = session.errors.dir
+			}
+		}
+	}
+
+	r.New, r.Changed, r.Removed, r.Unchanged = []string{}, []string{}, []string{}, []string{}
+	if prev != nil {
+		r.PreviousRun = prev.RunID
+	}
+	for class, failed := range r.Failures {
+		if class != "not-found" {
+			r.carryOver(prev, failed)
+		}
+	}
+	r.carryOver(prev, r.NotAttempted)
+	for id, hash := range r.Products {
+		unchanged := session != nil && session.unchanged[id]
+		if unchanged {
+			r.Unchanged = append(r.Unchanged, id)
+		}
+		switch old, ok := prev.product(id); {
+		case !ok:
+			r.New = append(r.New, id)
+		case old != hash && !unchanged:
+			r.Changed = append(r.Changed, id)
+		}
+	}
+	if prev != nil {
+		requested := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			requested[id] = true
+		}
+		gone := make(map[string]bool)
+		for _, id := range r.Failures["not-found"] {
+			gone[id] = true
+		}
+		for id := range prev.Products {
+			if _, ok := r.Products[id]; !ok && (!requested[id] || gone[id]) {
+				r.Removed = append(r.Removed, id)
+			}
+		}
+	}
+	sort.Strings(r.New)
+	sort.Strings(r.Changed)
+	sort.Strings(r.Removed)
+	sort.Strings(r.Unchanged)
+	for _, failed := range r.Failures {
+		sort.Strings(failed)
+	}
+}
+
+// product returns the hash of a product in r, which may be nil.
+func (r *runReport) product(id string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	hash, ok := r.Products[id]
+	return hash, ok
+}
+
+// write stores the report as report.json and report.txt in dir.
+func (r *runReport) write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create run directory: %v", err)
+	}
+	r.Outputs["report"] = filepath.Join(dir, reportJSONFile)
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, reportJSONFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, reportTextFile), []byte(r.text()), 0644); err != nil {
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	return nil
+}
+
+// text renders the report for people.
+func (r *runReport) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Run %s", r.RunID)
+	if r.Identity != "" {
+		fmt.Fprintf(&b, " (identity %s)", r.Identity)
+	}
+	fmt.Fprintf(&b, "\n  Duration:   %s (%.1f products/min)\n", r.Duration.Round(time.Second), r.ProductsPerMinute)
+	fmt.Fprintf(&b, "  Products:   %d requested, %d succeeded, %d failed\n", r.Requested, r.Succeeded, r.Failed)
+	if r.RobotsIgnored {
+		b.WriteString("  Robots.txt: IGNORED (-ignore-robots)\n")
+	} else {
+		b.WriteString("  Robots.txt: honored\n")
+	}
+
+	if s := r.Schedule; s != nil {
+		reasons := make([]string, 0, len(s.Reasons))
+		for reason, n := range s.Reasons {
+			reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+		}
+		sort.Strings(reasons)
+		fmt.Fprintf(&b, "  Schedule:   %d of %d products due, %d crawled (budget %d), %d deferred\n",
+			s.Due, s.Known, s.Scheduled, s.Budget, s.Deferred)
+		if len(reasons) > 0 {
+			fmt.Fprintf(&b, "    %-14s %s\n", "reasons", strings.Join(reasons, ", "))
+		}
+	}
+
+	if len(r.Failures) > 0 {
+		b.WriteString("  Failures:\n")
+		classes := make([]string, 0, len(r.Failures))
+		for class := range r.Failures {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(&b, "    %-14s %d: %s\n", class, len(r.Failures[class]), strings.Join(r.Failures[class], " "))
+		}
+	}
+	if len(r.NotAttempted) > 0 {
+		fmt.Fprintf(&b, "  Not attempted: %d (crawl stopped by schema drift)\n", len(r.NotAttempted))
+	}
+	if len(r.Retried) > 0 {
+		ids := make([]string, 0, len(r.Retried))
+		for id := range r.Retried {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for i, id := range ids {
+			ids[i] = fmt.Sprintf("%s(%d)", id, r.Retried[id])
+		}
+		fmt.Fprintf(&b, "  Retried:    %s\n", strings.Join(ids, " "))
+	}
+	if len(r.Unchanged) > 0 {
+		fmt.Fprintf(&b, "  HTTP cache: %d products unchanged\n", len(r.Unchanged))
+	}
+	if r.ErrorResponses > 0 {
+		fmt.Fprintf(&b, "  Errors:     %d failed responses saved\n", r.ErrorResponses)
+	}
+	if len(r.SchemaDrift) > 0 {
+		b.WriteString("  Schema drift:\n")
+		for _, s := range r.SchemaDrift {
+			fmt.Fprintf(&b, "    %s %s in %d responses (%.1f%%), e.g. %s\n",
+				s.Field, s.Problem, s.Count, s.Rate*100, strings.Join(s.Examples, " "))
+		}
+	}
+
+	if r.PreviousRun == "" {
+		fmt.Fprintf(&b, "  Changes:    %d new (no previous run)\n", len(r.New))
+	} else {
+		fmt.Fprintf(&b, "  Changes:    %d new, %d changed, %d removed since run %s\n",
+			len(r.New), len(r.Changed), len(r.Removed), r.PreviousRun)
+		for _, c := range []struct {
+			label string
+			ids   []string
+		}{{"new", r.New}, {"changed", r.Changed}, {"removed", r.Removed}} {
+			if len(c.ids) > 0 {
+				fmt.Fprintf(&b, "    %-14s %s\n", c.label, strings.Join(c.ids, " "))
+			}
+		}
+	}
+
+	if len(r.Outputs) > 0 {
+		b.WriteString("  Outputs:\n")
+		names := make([]string, 0, len(r.Outputs))
+		for name := range r.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "    %-14s %s\n", name, r.Outputs[name])
+		}
+	}
+	return b.String()
+}
+
+// loadPreviousReport returns the report of the newest run in runsDir that
+// started before the run in current and wrote a report, or nil if there is
+// none.
+func loadPreviousReport(runsDir, current string) (*runReport, error) {
+	entries, err := os.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %v", err)
+	}
+	currentID := filepath.Base(current)
+	// Run IDs are UTC timestamps, so they sort by start time.
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !e.IsDir() || e.Name() >= currentID {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(runsDir, e.Name(), reportJSONFile))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run report: %v", err)
+		}
+		var r runReport
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("failed to parse run report %s: %v", e.Name(), err)
+		}
+		return &r, nil
+	}
+	return nil, nil
+}
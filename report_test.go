@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReportChanges(t *testing.T) {
+	runsDir := t.TempDir()
+	start := time.Date(2025, 6, 23, 9, 0, 0, 0, time.UTC)
+
+	first := newRunReport(filepath.Join(runsDir, "20250623T090000Z"), start)
+	for _, id := range []string{"IA4845", "KB5435", "HB9386", "JI2345", "GONE01"} {
+		first.recordSuccess(&ProductData{ID: id, Price: "5000 JPY"})
+	}
+	first.finish(nil, []string{"IA4845", "KB5435", "HB9386", "JI2345", "GONE01"}, nil, start.Add(time.Minute))
+	if err := first.write(filepath.Join(runsDir, first.RunID)); err != nil {
+		t.Fatal(err)
+	}
+
+	secondDir := filepath.Join(runsDir, "20250624T090000Z")
+	prev, err := loadPreviousReport(runsDir, secondDir)
+	if err != nil || prev == nil || prev.RunID != first.RunID {
+		t.Fatalf("previous report = %+v, %v", prev, err)
+	}
+
+	// HB9386 is no longer in the SKU list, GONE01 disappeared from the site
+	// and JI2345 was blocked, so it is not known to be removed.
+	second := newRunReport(secondDir, start.Add(24*time.Hour))
+	second.recordSuccess(&ProductData{ID: "IA4845", Price: "5000 JPY"})
+	second.recordSuccess(&ProductData{ID: "KB5435", Price: "4000 JPY"})
+	second.recordSuccess(&ProductData{ID: "NEW001", Price: "3000 JPY"})
+	second.recordFailure("JI2345", fmt.Errorf("failed to fetch product JI2345: %w", &crawlError{"challenge", fmt.Errorf("blocked by akamai-challenge challenge")}))
+	second.recordFailure("GONE01", &crawlError{"not-found", fmt.Errorf("failed with status: 404")})
+	second.finish(nil, []string{"IA4845", "KB5435", "NEW001", "JI2345", "GONE01"}, prev, start.Add(24*time.Hour+2*time.Minute))
+
+	if !reflect.DeepEqual(second.New, []string{"NEW001"}) ||
+		!reflect.DeepEqual(second.Changed, []string{"KB5435"}) ||
+		!reflect.DeepEqual(second.Removed, []string{"GONE01", "HB9386"}) {
+		t.Errorf("new %v, changed %v, removed %v", second.New, second.Changed, second.Removed)
+	}
+	if second.Requested != 5 || second.Succeeded != 3 || second.Failed != 2 || second.ProductsPerMinute != 1.5 {
+		t.Errorf("totals = %+v", second)
+	}
+	if ids := second.Failures["challenge"]; len(ids) != 1 || ids[0] != "JI2345" {
+		t.Errorf("failures = %v", second.Failures)
+	}
+
+	if err := second.write(secondDir); err != nil {
+		t.Fatal(err)
+	}
+	text, err := os.ReadFile(filepath.Join(secondDir, reportTextFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"5 requested, 3 succeeded, 2 failed", "1 new, 1 changed, 2 removed since run 20250623T090000Z", "not-found      1: GONE01"} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("report text lacks %q:\n%s", want, text)
+		}
+	}
+
+	// The blocked JI2345 kept its hash, so it is unchanged once it is
+	// fetched again.
+	third := newRunReport(filepath.Join(runsDir, "20250625T090000Z"), start.Add(48*time.Hour))
+	third.recordSuccess(&ProductData{ID: "JI2345", Price: "5000 JPY"})
+	third.finish(nil, []string{"JI2345"}, second, start.Add(48*time.Hour+time.Minute))
+	if len(third.New) != 0 || len(third.Changed) != 0 {
+		t.Errorf("after a block: new %v, changed %v", third.New, third.Changed)
+	}
+}
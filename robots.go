@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsTTL is how long a host's robots.txt is used before it is fetched
+// again, the maximum RFC 9309 allows. After a failed fetch the host stays
+// disallowed for robotsRetry.
+const (
+	robotsTTL   = 24 * time.Hour
+	robotsRetry = 10 * time.Minute
+)
+
+// robotsRule is one Allow or Disallow line. Patterns are percent-encoded
+// paths that may contain * and end with $.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	pattern = normalizeRobotsPath(pattern)
+	expr := strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(expr, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr = "^" + strings.Join(parts, ".*")
+	if strings.HasSuffix(pattern, "$") {
+		expr += "$"
+	}
+	return robotsRule{allow: allow, pattern: pattern, re: regexp.MustCompile(expr)}
+}
+
+// robotsGroup holds the rules of the user agents named by one group.
+type robotsGroup struct {
+	agents     []string // lower-cased product tokens
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsTxt is a parsed robots.txt.
+type robotsTxt struct {
+	groups []*robotsGroup
+}
+
+// parseRobotsTxt parses robots.txt as described by RFC 9309, plus the
+// non-standard Crawl-delay. Consecutive User-agent lines start one group;
+// Sitemap and unknown lines are ignored.
+func parseRobotsTxt(body []byte) *robotsTxt {
+	robots := &robotsTxt{}
+	var group *robotsGroup
+	inAgents := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				robots.groups = append(robots.groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			continue
+		case "allow", "disallow":
+			if group != nil && value != "" {
+				group.rules = append(group.rules, newRobotsRule(key == "allow", value))
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && group != nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		inAgents = false
+	}
+	return robots
+}
+
+// normalizeRobotsPath percent-encodes a path pattern the way URL paths are
+// compared, so raw and encoded non-ASCII rules (/メンズ, /%E3%83%A1...) match
+// the same URLs. Wildcards are left as they are.
+func normalizeRobotsPath(pattern string) string {
+	path, query, hasQuery := strings.Cut(pattern, "?")
+	parts := strings.Split(path, "*")
+	for i, part := range parts {
+		if decoded, err := url.PathUnescape(part); err == nil {
+			parts[i] = (&url.URL{Path: decoded}).EscapedPath()
+		}
+	}
+	path = strings.Join(parts, "*")
+	if hasQuery {
+		path += "?" + query
+	}
+	return path
+}
+
+// group returns the group for agent: the one whose product token is the
+// longest contained in agent, else the * group. It returns nil when no group
+// applies.
+func (r *robotsTxt) group(agent string) *robotsGroup {
+	agent = strings.ToLower(agent)
+	var best, fallback *robotsGroup
+	bestLen := 0
+	for _, g := range r.groups {
+		for _, token := range g.agents {
+			switch {
+			case token == "*":
+				if fallback == nil {
+					fallback = g
+				}
+			case strings.Contains(agent, token) && len(token) > bestLen:
+				best, bestLen = g, len(token)
+			}
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return fallback
+}
+
+// allowed reports whether agent may fetch the path (with query) of u. The
+// longest matching rule wins; on a tie Allow wins.
+func (r *robotsTxt) allowed(agent string, u *url.URL) bool {
+	if u.Path == "/robots.txt" {
+		return true
+	}
+	g := r.group(agent)
+	if g == nil {
+		return true
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	allow, matched := true, -1
+	for _, rule := range g.rules {
+		if n := len(rule.pattern); n >= matched && rule.re.MatchString(path) {
+			if n > matched || rule.allow {
+				allow = rule.allow
+			}
+			matched = n
+		}
+	}
+	return allow
+}
+
+// robotsPolicy fetches, caches and enforces the robots.txt of every host the
+// session talks to.
+type robotsPolicy struct {
+	agent    string           // user agent the rules are picked for
+	identity *browserIdentity // headers robots.txt is requested with; nil sends only agent
+	client   *http.Client
+	limiter  *rateLimiter
+	now      func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	robots  *robotsTxt // nil disallows everything
+	expires time.Time
+}
+
+func newRobotsPolicy(agent string, identity *browserIdentity, client *http.Client, limiter *rateLimiter) *robotsPolicy {
+	return &robotsPolicy{
+		agent:    agent,
+		identity: identity,
+		client:   client,
+		limiter:  limiter,
+		now:      time.Now,
+		hosts:    make(map[string]*robotsEntry),
+	}
+}
+
+// check returns an error when robots.txt disallows u. The host's robots.txt
+// is fetched on first use and once it expires; its crawl-delay, if longer
+// than the configured interval, becomes the host's rate limit. A nil policy
+// allows everything.
+func (p *robotsPolicy) check(u *url.URL) error {
+	if p == nil {
+		return nil
+	}
+	entry := p.entry(u)
+	if entry.robots == nil {
+		return fmt.Errorf("robots.txt of %s could not be fetched, so all URLs are disallowed", u.Host)
+	}
+	if !entry.robots.allowed(p.agent, u) {
+		return fmt.Errorf("disallowed by robots.txt of %s", u.Host)
+	}
+	return nil
+}
+
+func (p *robotsPolicy) entry(u *url.URL) *robotsEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.hosts[u.Host]; ok && p.now().Before(entry.expires) {
+		return entry
+	}
+	entry := &robotsEntry{robots: p.fetch(u), expires: p.now().Add(robotsTTL)}
+	p.hosts[u.Host] = entry
+	if entry.robots == nil {
+		entry.expires = p.now().Add(robotsRetry)
+	} else {
+		if g := entry.robots.group(p.agent); g != nil && g.crawlDelay > 0 {
+			p.limiter.setMinInterval(u.Host, g.crawlDelay)
+			slog.Info("Honoring robots.txt crawl-delay", "host", u.Host, "delay", g.crawlDelay)
+		}
+	}
+	return entry
+}
+
+// fetch downloads robots.txt for the host of u with the session identity's
+// headers, since bot protection answers bare requests with 403. Only a
+// missing robots.txt (404 or 410) allows everything. A block (401, 403, 429
+// or a challenge page), any other error status or a network error
+// disallows everything (nil) until the next attempt.
+func (p *robotsPolicy) fetch(u *url.URL) *robotsTxt {
+	robotsURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String()
+	p.limiter.wait(u.Host)
+	req, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		return nil
+	}
+	if p.identity != nil {
+		p.identity.apply(req, destDocument, "none", "")
+	} else {
+		req.Header.Set("User-Agent", p.agent)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		slog.Warn("Failed to fetch robots.txt, disallowing the host", "url", robotsURL, "error", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		slog.Info("No robots.txt, allowing the host", "url", robotsURL, "status", resp.StatusCode)
+		return &robotsTxt{}
+	}
+	resp.Body = io.NopCloser(io.LimitReader(resp.Body, 500<<10))
+	body, err := readResponseBody(resp)
+	if err != nil {
+		slog.Warn("Failed to read robots.txt, disallowing the host", "url", robotsURL, "error", err)
+		return nil
+	}
+	// robots.txt is plain text, so an HTML answer is inspected like one to
+	// an API call.
+	if challenge, ok := detectChallenge(resp.StatusCode, resp.Header, body, destAPI); ok {
+		slog.Warn("Robots.txt request was blocked, disallowing the host", "url", robotsURL, "status", resp.StatusCode, "challenge", challenge)
+		return nil
+	}
+	if resp.StatusCode >= 400 {
+		slog.Warn("Failed to fetch robots.txt, disallowing the host", "url", robotsURL, "status", resp.StatusCode)
+		return nil
+	}
+	robots := parseRobotsTxt(body)
+	slog.Info("Loaded robots.txt", "url", robotsURL, "groups", len(robots.groups))
+	return robots
+}
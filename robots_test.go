@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testRobotsTxt = `# comment
+User-agent: *
+Disallow: /search
+Disallow: /api/
+Allow: /api/products/
+Disallow: /*.pdf$
+Disallow: /メンズ-アウトレット
+
+User-agent: BadBot
+User-agent: Scraper
+Disallow: /
+
+User-agent: adidas-crawler
+Disallow: /private
+Crawl-delay: 2.5
+
+Sitemap: https://www.adidas.jp/sitemap.xml
+`
+
+func TestRobotsTxtAllowed(t *testing.T) {
+	robots := parseRobotsTxt([]byte(testRobotsTxt))
+	tests := []struct {
+		agent, url string
+		want       bool
+	}{
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/search?q=tee", false},
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/api/search/taxonomy", false},
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/api/products/IA4845", true},
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/size-chart.pdf", false},
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/size-chart.pdf?v=2", true},
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/%E3%83%A1%E3%83%B3%E3%82%BA-%E3%82%A2%E3%82%A6%E3%83%88%E3%83%AC%E3%83%83%E3%83%88", false},
+		{"Mozilla/5.0 Chrome/126.0", "https://www.adidas.jp/メンズ-tシャツ", true},
+		{"scraper/1.0", "https://www.adidas.jp/api/products/IA4845", false},
+		{"scraper/1.0", "https://www.adidas.jp/robots.txt", true},
+		// The adidas-crawler group replaces the * group.
+		{"adidas-crawler/1.0", "https://www.adidas.jp/search", true},
+		{"adidas-crawler/1.0", "https://www.adidas.jp/private/x", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := robots.allowed(tt.agent, u); got != tt.want {
+			t.Errorf("allowed(%q, %s) = %v, want %v", tt.agent, tt.url, got, tt.want)
+		}
+	}
+	if g := robots.group("adidas-crawler/1.0"); g == nil || g.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("crawl-delay group = %+v", g)
+	}
+}
+
+func TestRobotsPolicyBlocksDisallowedURLs(t *testing.T) {
+	m := newMockAdidas(t)
+	session, _ := newMockSession(m, 0)
+	session.robots = newRobotsPolicy("adidas-crawler/1.0", session.identity, session.client, session.limiter)
+
+	_, err := session.fetch(m.URL()+"/search?q=tee", 3, requestOptions{dest: destDocument})
+	var cerr *crawlError
+	if !errors.As(err, &cerr) || cerr.class != "robots" {
+		t.Fatalf("fetch /search: error = %v, want a robots error", err)
+	}
+	if _, err := session.fetch(m.URL()+"/api/products/IA4845", 3, requestOptions{}); err != nil {
+		t.Fatalf("fetch product: %v", err)
+	}
+	if got := m.requestCount("/robots.txt"); got != 1 {
+		t.Errorf("robots.txt requested %d times", got)
+	}
+	if got := m.requestCount("/search"); got != 0 {
+		t.Errorf("disallowed URL requested %d times", got)
+	}
+}
+
+func TestRobotsPolicyCrawlDelayAndFailures(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("User-agent: *\nCrawl-delay: 0.01\n"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/api/products/IA4845")
+
+	now := time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(0, 0)
+	policy := newRobotsPolicy("adidas-crawler/1.0", nil, server.Client(), limiter)
+	policy.now = func() time.Time { return now }
+
+	if err := policy.check(u); err != nil {
+		t.Fatal(err)
+	}
+	if got := limiter.min[u.Host]; got != 10*time.Millisecond {
+		t.Errorf("min interval = %v, want 10ms", got)
+	}
+
+	// A server error disallows the host until robotsRetry has passed.
+	status = http.StatusServiceUnavailable
+	now = now.Add(robotsTTL)
+	if err := policy.check(u); err == nil {
+		t.Error("check after a 503 succeeded")
+	}
+	status = http.StatusNotFound
+	now = now.Add(robotsRetry - time.Second)
+	if err := policy.check(u); err == nil {
+		t.Error("check before robotsRetry fetched robots.txt again")
+	}
+	now = now.Add(time.Second)
+	if err := policy.check(u); err != nil {
+		t.Errorf("check after a 404: %v", err)
+	}
+}
+
+func TestRobotsPolicyBlockedRobotsTxtBlocksCrawl(t *testing.T) {
+	m := newMockAdidas(t)
+	m.fail("/robots.txt", m.botChallenge())
+	session, _ := newMockSession(m, 0)
+	session.robots = newRobotsPolicy("adidas-crawler/1.0", session.identity, session.client, session.limiter)
+
+	_, err := session.getProductDetails("IA4845")
+	var cerr *crawlError
+	if !errors.As(err, &cerr) || cerr.class != "robots" {
+		t.Fatalf("crawl with a blocked robots.txt: error = %v, want a robots error", err)
+	}
+	if got := m.requestCount("/api/products/IA4845"); got != 0 {
+		t.Errorf("product requested %d times although robots.txt was blocked", got)
+	}
+
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusBadRequest} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		u, _ := url.Parse(server.URL + "/api/products/IA4845")
+		policy := newRobotsPolicy("adidas-crawler/1.0", nil, server.Client(), newRateLimiter(0, 0))
+		if err := policy.check(u); err == nil {
+			t.Errorf("robots.txt answered with %d allowed the host", status)
+		}
+		server.Close()
+	}
+}
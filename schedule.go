@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// maxPriceHistory bounds the price changes kept per product.
+	maxPriceHistory = 20
+	// volatileShare is the share of observations with a price change from
+	// which a product is refreshed as often as sale items.
+	volatileShare = 0.2
+	// lowStockSizes is the number of listed sizes at or below which an
+	// orderable product counts as low on stock.
+	lowStockSizes = 2
+	// newArrivalWindow is how long a product counts as a new arrival after it
+	// was first seen.
+	newArrivalWindow = 7 * 24 * time.Hour
+)
+
+// Stock statuses of productState.
+const (
+	stockIn  = "in"
+	stockLow = "low"
+	stockOut = "out"
+)
+
+// pricePoint is a price observed from At on.
+type pricePoint struct {
+	At    time.Time `json:"at"`
+	Price float64   `json:"price"`
+}
+
+// productState is what earlier runs learned about a product, used to decide
+// when it is due again.
+type productState struct {
+	FirstSeen    time.Time    `json:"first_seen"`
+	LastFetched  time.Time    `json:"last_fetched"` // last successful fetch
+	LastAttempt  time.Time    `json:"last_attempt"` // last failed fetch, zero after a success
+	Observations int          `json:"observations"`
+	Prices       []pricePoint `json:"prices"` // price changes, oldest first
+	OnSale       bool         `json:"on_sale"`
+	Stock        string       `json:"stock"`
+}
+
+// volatility is the share of observations after the first that saw a new
+// price, between 0 and 1.
+func (st *productState) volatility() float64 {
+	if st.Observations < 2 || len(st.Prices) < 2 {
+		return 0
+	}
+	return float64(len(st.Prices)-1) / float64(st.Observations-1)
+}
+
+// stockStatus classifies the availability of p. The API lists the sizes
+// still offered, so few of them means low stock.
+func stockStatus(p *ProductData) string {
+	switch {
+	case !p.Orderable:
+		return stockOut
+	case len(p.Variations) > 0 && len(p.Variations) <= lowStockSizes:
+		return stockLow
+	}
+	return stockIn
+}
+
+// crawlState is the per-product state kept across runs in the state file,
+// keyed by product ID. It is a ProductSink, so every crawl keeps it current.
+type crawlState struct {
+	filename string
+	now      func() time.Time
+	Products map[string]*productState `json:"products"`
+}
+
+// loadCrawlState reads the state file. A missing file yields an empty state.
+func loadCrawlState(filename string) (*crawlState, error) {
+	st := &crawlState{filename: filename, now: time.Now, Products: make(map[string]*productState)}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crawl state: %v", err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to parse crawl state %s: %v", filename, err)
+	}
+	if st.Products == nil {
+		st.Products = make(map[string]*productState)
+	}
+	return st, nil
+}
+
+func (st *crawlState) product(id string) *productState {
+	p, ok := st.Products[id]
+	if !ok {
+		p = &productState{FirstSeen: st.now().UTC()}
+		st.Products[id] = p
+	}
+	return p
+}
+
+func (st *crawlState) Name() string { return "state" }
+
+// WriteProduct records a successful fetch of p.
+func (st *crawlState) WriteProduct(p *ProductData) error {
+	now := st.now().UTC()
+	ps := st.product(p.ID)
+	ps.LastFetched = now
+	ps.LastAttempt = time.Time{}
+	ps.Observations++
+	if n := len(ps.Prices); n == 0 || ps.Prices[n-1].Price != p.CurrentPrice {
+		ps.Prices = append(ps.Prices, pricePoint{At: now, Price: p.CurrentPrice})
+		if len(ps.Prices) > maxPriceHistory {
+			ps.Prices = ps.Prices[len(ps.Prices)-maxPriceHistory:]
+		}
+	}
+	ps.OnSale = p.OnSale
+	ps.Stock = stockStatus(p)
+	return nil
+}
+
+// attempted records failed fetches, so a product that keeps failing waits a
+// full interval before it is tried again.
+func (st *crawlState) attempted(ids []string) {
+	now := st.now().UTC()
+	for _, id := range ids {
+		st.product(id).LastAttempt = now
+	}
+}
+
+// Close saves the state file.
+func (st *crawlState) Close() error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode crawl state: %v", err)
+	}
+	if err := os.WriteFile(st.filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write crawl state: %v", err)
+	}
+	return nil
+}
+
+// ScheduleOptions configures the incremental crawl.
+type ScheduleOptions struct {
+	Budget       int           // maximum products per run
+	HotInterval  time.Duration // refresh interval of sale, low-stock and volatile products
+	FullInterval time.Duration // refresh interval of every other product
+}
+
+// scheduledProduct is a product with its refresh priority. Due products
+// have a priority of at least 1.
+type scheduledProduct struct {
+	ID       string
+	Priority float64
+	Reason   string // new, modified, sale, low-stock, volatile or stale
+}
+
+// scheduleSummary describes an incremental run in the run report.
+type scheduleSummary struct {
+	Budget    int            `json:"budget"`
+	Known     int            `json:"known"`     // products in the SKU file
+	Due       int            `json:"due"`       // products due for a refresh
+	Scheduled int            `json:"scheduled"` // due products crawled within the budget
+	Deferred  int            `json:"deferred"`  // due products left for the next run
+	Reasons   map[string]int `json:"reasons"`   // reason -> scheduled products
+}
+
+// Priorities of new products and of products modified in the sitemap. The
+// latter grow with the age of the change, but stay below new products.
+const (
+	newPriority      = 1000
+	modifiedPriority = 100
+)
+
+// priority works out how urgently the product id needs a refresh at now.
+// Products never fetched come first, then those modified in the sitemap
+// since they were last fetched or tried. Others are due once an interval
+// has passed since their last fetch or failed attempt: the hot interval for
+// sale, low-stock and volatile products, the full interval for the rest.
+// Overdue products rank by how many intervals they are overdue, weighted up
+// by price volatility and for new arrivals.
+func (st *crawlState) priority(id, lastMod string, now time.Time, opts ScheduleOptions) scheduledProduct {
+	ps, ok := st.Products[id]
+	if !ok || ps.LastFetched.IsZero() && ps.LastAttempt.IsZero() {
+		return scheduledProduct{ID: id, Priority: newPriority, Reason: "new"}
+	}
+	last := ps.LastFetched
+	if ps.LastAttempt.After(last) {
+		last = ps.LastAttempt
+	}
+	if lastMod != "" {
+		if t, err := time.Parse(time.RFC3339, lastMod); err == nil && t.After(last) && !ps.LastFetched.IsZero() {
+			priority := min(modifiedPriority+now.Sub(t).Hours(), newPriority-1)
+			return scheduledProduct{ID: id, Priority: priority, Reason: "modified"}
+		}
+	}
+
+	volatility := ps.volatility()
+	interval, reason := opts.FullInterval, "stale"
+	switch {
+	case ps.OnSale:
+		interval, reason = opts.HotInterval, "sale"
+	case ps.Stock == stockLow:
+		interval, reason = opts.HotInterval, "low-stock"
+	case volatility >= volatileShare:
+		interval, reason = opts.HotInterval, "volatile"
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	priority := float64(now.Sub(last)) / float64(interval)
+	if priority >= 1 {
+		priority *= 1 + volatility
+		if now.Sub(ps.FirstSeen) < newArrivalWindow {
+			priority *= 2
+		}
+	}
+	return scheduledProduct{ID: id, Priority: priority, Reason: reason}
+}
+
+// schedule picks the products of ids to crawl now: the due ones, highest
+// priority first, up to the budget. lastMods maps IDs to their sitemap
+// lastmod, see saveLastMod.
+func (st *crawlState) schedule(ids []string, lastMods map[string]sitemapProduct, opts ScheduleOptions) ([]scheduledProduct, *scheduleSummary) {
+	now := st.now().UTC()
+	summary := &scheduleSummary{Budget: opts.Budget, Known: len(ids), Reasons: make(map[string]int)}
+	var due []scheduledProduct
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if p := st.priority(id, lastMods[id].LastMod, now, opts); p.Priority >= 1 {
+			due = append(due, p)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		return due[i].ID < due[j].ID
+	})
+	summary.Due = len(due)
+	if opts.Budget > 0 && len(due) > opts.Budget {
+		due = due[:opts.Budget]
+	}
+	summary.Scheduled = len(due)
+	summary.Deferred = summary.Due - summary.Scheduled
+	for _, p := range due {
+		summary.Reasons[p.Reason]++
+	}
+	slog.Info("Scheduled incremental crawl", "known", summary.Known, "due", summary.Due,
+		"scheduled", summary.Scheduled, "deferred", summary.Deferred, "budget", opts.Budget)
+	return due, summary
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulePrioritizesDueProducts(t *testing.T) {
+	now := time.Date(2025, 6, 23, 12, 0, 0, 0, time.UTC)
+	firstSeen := now.Add(-30 * 24 * time.Hour)
+	st := &crawlState{now: func() time.Time { return now }, Products: map[string]*productState{
+		"SALE01": {FirstSeen: firstSeen, LastFetched: now.Add(-90 * time.Minute), Observations: 3, OnSale: true, Stock: stockIn},
+		"LOW001": {FirstSeen: firstSeen, LastFetched: now.Add(-30 * time.Minute), Observations: 3, Stock: stockLow},
+		"REG001": {FirstSeen: firstSeen, LastFetched: now.Add(-2 * time.Hour), Observations: 3, Stock: stockIn},
+		"OLD001": {FirstSeen: firstSeen, LastFetched: now.Add(-25 * time.Hour), Observations: 3, Stock: stockIn},
+		"MOD001": {FirstSeen: firstSeen, LastFetched: now.Add(-2 * time.Hour), Observations: 3, Stock: stockIn},
+		"MOD002": {FirstSeen: firstSeen, LastFetched: now.Add(-90 * 24 * time.Hour), Observations: 3, Stock: stockIn},
+		// Two of three observations after the first saw a new price.
+		"VOL001": {FirstSeen: firstSeen, LastFetched: now.Add(-70 * time.Minute), Observations: 4, Stock: stockIn,
+			Prices: []pricePoint{{Price: 5000}, {Price: 4000}, {Price: 5000}}},
+		"FAIL01": {FirstSeen: firstSeen, LastAttempt: now.Add(-time.Hour), Stock: stockIn},
+		// Modified since its last fetch, but the retry after that failed.
+		"FAIL02": {FirstSeen: firstSeen, LastFetched: now.Add(-3 * time.Hour), LastAttempt: now.Add(-time.Hour), Observations: 3, Stock: stockIn},
+	}}
+	lastMods := map[string]sitemapProduct{
+		"MOD001": {ID: "MOD001", LastMod: "2025-06-23T11:00:00Z"},
+		"FAIL02": {ID: "FAIL02", LastMod: "2025-06-23T10:00:00Z"},
+		// Modified 60 days ago, which still ranks below a new product.
+		"MOD002": {ID: "MOD002", LastMod: "2025-04-24T12:00:00Z"},
+	}
+	ids := []string{"REG001", "SALE01", "LOW001", "OLD001", "MOD001", "MOD002", "VOL001", "NEW001", "FAIL01", "FAIL02"}
+
+	scheduled, summary := st.schedule(ids, lastMods, ScheduleOptions{Budget: 4, HotInterval: time.Hour, FullInterval: 24 * time.Hour})
+	var got []string
+	for _, p := range scheduled {
+		got = append(got, p.ID+":"+p.Reason)
+	}
+	// SALE01 (90m / 1h) and OLD001 (25h / 24h) rank below them and are deferred.
+	want := []string{"NEW001:new", "MOD002:modified", "MOD001:modified", "VOL001:volatile"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scheduled = %v, want %v", got, want)
+	}
+	wantSummary := &scheduleSummary{Budget: 4, Known: 10, Due: 6, Scheduled: 4, Deferred: 2,
+		Reasons: map[string]int{"new": 1, "modified": 2, "volatile": 1}}
+	if !reflect.DeepEqual(summary, wantSummary) {
+		t.Errorf("summary = %+v, want %+v", summary, wantSummary)
+	}
+}
+
+func TestCrawlStateRecordsFetches(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	st, err := loadCrawlState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, price := range []float64{5000, 5000, 4000} {
+		p := &ProductData{ID: "IA4845", CurrentPrice: price, OnSale: price < 5000, Orderable: true,
+			Variations: []Variation{{Size: "M"}}}
+		if err := st.WriteProduct(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st.attempted([]string{"KB5435"})
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCrawlState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := loaded.Products["IA4845"]
+	if ps == nil || ps.Observations != 3 || len(ps.Prices) != 2 || !ps.OnSale || ps.Stock != stockLow {
+		t.Fatalf("state = %+v", ps)
+	}
+	if v := ps.volatility(); v != 0.5 {
+		t.Errorf("volatility = %v, want 0.5", v)
+	}
+	if failed := loaded.Products["KB5435"]; failed == nil || failed.LastAttempt.IsZero() || !failed.LastFetched.IsZero() {
+		t.Errorf("failed product state = %+v", failed)
+	}
+}
+
+func TestRunReportCarryOver(t *testing.T) {
+	start := time.Date(2025, 6, 23, 9, 0, 0, 0, time.UTC)
+	prev := newRunReport("runs/20250623T080000Z", start.Add(-time.Hour))
+	for _, id := range []string{"IA4845", "KB5435", "HB9386"} {
+		prev.recordSuccess(&ProductData{ID: id})
+	}
+
+	// Only IA4845 was due; HB9386 left the SKU file.
+	r := newRunReport("runs/20250623T090000Z", start)
+	r.recordSuccess(&ProductData{ID: "IA4845"})
+	r.carryOver(prev, []string{"IA4845", "KB5435"})
+	r.finish(nil, []string{"IA4845"}, prev, start.Add(time.Minute))
+
+	if len(r.New) != 0 || len(r.Changed) != 0 || !reflect.DeepEqual(r.Removed, []string{"HB9386"}) {
+		t.Errorf("new = %v, changed = %v, removed = %v", r.New, r.Changed, r.Removed)
+	}
+	if _, ok := r.Products["KB5435"]; !ok || r.Succeeded != 1 {
+		t.Errorf("products = %v, succeeded = %d", r.Products, r.Succeeded)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ProductSink is an output backend that receives every product the crawler
+// parses successfully.
+type ProductSink interface {
+	Name() string
+	WriteProduct(p *ProductData) error
+	Close() error
+}
+
+// excelListOptions joins list cells in the spreadsheet, where each value sits
+// in its own cell and commas are unambiguous.
+var excelListOptions = CSVOptions{ListDelimiter: ","}
+
+type excelSink struct {
+	f        *excelize.File
+	filename string
+	sheet    string
+	mode     WriteMode
+	table    *productTable
+}
+
+func newExcelSink(filename string, mode WriteMode) (*excelSink, error) {
+	f, _, err := initExcel(filename)
+	if err != nil {
+		return nil, err
+	}
+	sink := &excelSink{f: f, filename: filename, sheet: "Products", mode: mode}
+	if sink.table, err = loadExcelTable(f, sink.sheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	slog.Info("Loaded existing rows", "file", filename, "rows", len(sink.table.rows), "products", len(sink.table.latest))
+	return sink, nil
+}
+
+// loadExcelTable indexes the data rows of sheet by product ID. Sheets written
+// with an earlier column layout (see csvSchemaHistory) are rewritten in the
+// current one.
+func loadExcelTable(f *excelize.File, sheet string) (*productTable, error) {
+	table := newProductTable()
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rows of sheet %s: %v", sheet, err)
+	}
+	if len(rows) == 0 {
+		return table, nil
+	}
+
+	header := rows[0]
+	version := detectCSVSchemaVersion(header)
+	if version == 0 {
+		return nil, fmt.Errorf("sheet %s has an unrecognized header: %q", sheet, header)
+	}
+	index := headerIndex(header, version)
+
+	width := len(productColumns) + 1
+	for _, row := range rows[1:] {
+		if len(row) == 0 || row[0] == "" {
+			continue
+		}
+		record := make([]string, width)
+		for i, col := range productColumns {
+			if pos, ok := index[col.header]; ok && pos < len(row) {
+				record[i] = row[pos]
+			}
+		}
+		record[width-1] = "1"
+		if pos, ok := index[versionHeader]; ok && pos < len(row) && row[pos] != "" {
+			record[width-1] = row[pos]
+		}
+		table.load(record)
+	}
+
+	if version != csvSchemaVersion {
+		slog.Info("Upgrading Excel sheet layout", "sheet", sheet, "from_version", version, "to_version", csvSchemaVersion)
+		if err := writeExcelHeader(f, sheet); err != nil {
+			return nil, err
+		}
+		for i, record := range table.rows {
+			for col, value := range record {
+				cell, _ := excelize.CoordinatesToCellName(col+1, i+2)
+				f.SetCellValue(sheet, cell, value)
+			}
+		}
+	}
+	return table, nil
+}
+
+func (s *excelSink) Name() string { return "excel" }
+
+func (s *excelSink) WriteProduct(p *ProductData) error {
+	action, idx := s.table.apply(productRecord(p, excelListOptions), s.mode)
+	if action == actionSkip {
+		slog.Debug("Product unchanged, skipping", "id", p.ID, "sink", s.Name())
+		return nil
+	}
+	// Row 1 holds the header.
+	return writeProductToExcel(s.f, s.sheet, idx+2, s.table.rows[idx], s.filename)
+}
+
+func (s *excelSink) Close() error {
+	if err := s.f.SaveAs(s.filename); err != nil {
+		slog.Error("Failed to perform final save of Excel file", "file", s.filename, "error", err)
+	}
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("failed to close Excel file: %v", err)
+	}
+	var size int64
+	if stat, err := os.Stat(s.filename); err == nil {
+		size = stat.Size()
+	}
+	slog.Info("Closed Excel file", "file", s.filename, "summary", s.table.summary(), "bytes", size)
+	return nil
+}
+
+// csvRewriteEvery bounds the in-place updates a crash can lose: the CSV
+// file is rewritten after this many of them, and on Close.
+const csvRewriteEvery = 100
+
+type csvSink struct {
+	file     *os.File
+	writer   *csv.Writer
+	filename string
+	opts     CSVOptions
+	mode     WriteMode
+	table    *productTable
+	pending  int // rows updated in place since the file was last rewritten
+}
+
+func newCSVSink(filename string, opts CSVOptions, mode WriteMode) (*csvSink, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	table, upgrade, err := loadCSVTable(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	if upgrade {
+		if err := rewriteCSV(filename, table, opts); err != nil {
+			return nil, fmt.Errorf("failed to upgrade CSV file %s: %v", filename, err)
+		}
+	}
+	slog.Info("Loaded existing rows", "file", filename, "rows", len(table.rows), "products", len(table.latest))
+
+	file, writer, err := initCSV(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &csvSink{file: file, writer: writer, filename: filename, opts: opts, mode: mode, table: table}, nil
+}
+
+func (s *csvSink) Name() string { return "csv" }
+
+func (s *csvSink) WriteProduct(p *ProductData) error {
+	action, idx := s.table.apply(productRecord(p, s.opts), s.mode)
+	switch action {
+	case actionSkip:
+		slog.Debug("Product unchanged, skipping", "id", p.ID, "sink", s.Name())
+		return nil
+	case actionAppend:
+		return writeProductToCSV(s.writer, s.table.rows[idx], s.filename)
+	}
+
+	// Updating a row in place means rewriting the file. The merged table is
+	// kept in memory and written every csvRewriteEvery updates and by Close;
+	// appends still go straight to the file.
+	slog.Debug("Replacing row in CSV", "id", p.ID)
+	s.pending++
+	if s.pending >= csvRewriteEvery {
+		return s.rewrite()
+	}
+	return nil
+}
+
+// rewrite writes the merged table to the file and reopens it for appends.
+func (s *csvSink) rewrite() error {
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return fmt.Errorf("failed to flush CSV writer: %v", err)
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close CSV file: %v", err)
+	}
+	if err := rewriteCSV(s.filename, s.table, s.opts); err != nil {
+		return fmt.Errorf("failed to rewrite CSV file: %v", err)
+	}
+	file, writer, err := initCSV(s.filename, s.opts)
+	if err != nil {
+		return err
+	}
+	s.file, s.writer, s.pending = file, writer, 0
+	slog.Debug("Rewrote CSV file with updated rows", "file", s.filename)
+	return nil
+}
+
+func (s *csvSink) Close() error {
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		slog.Error("Failed to flush CSV writer", "file", s.filename, "error", err)
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close CSV file: %v", err)
+	}
+	if s.pending > 0 {
+		if err := rewriteCSV(s.filename, s.table, s.opts); err != nil {
+			return fmt.Errorf("failed to rewrite CSV file: %v", err)
+		}
+	}
+	var size int64
+	if stat, err := os.Stat(s.filename); err == nil {
+		size = stat.Size()
+	}
+	slog.Info("Closed CSV file", "file", s.filename, "summary", s.table.summary(), "bytes", size)
+	return nil
+}
+
+func closeSinks(sinks []ProductSink) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			slog.Error("Failed to close output", "sink", sink.Name(), "error", err)
+		}
+	}
+}
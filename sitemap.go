@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSitemapDepth bounds how deep sitemap indexes may nest.
+const maxSitemapDepth = 3
+
+// sitemapProduct is a product page listed in a sitemap.
+type sitemapProduct struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	LastMod string `json:"lastmod,omitempty"` // RFC 3339, UTC; empty when the sitemap has none
+}
+
+// sitemapDocument decodes both sitemap indexes (<sitemapindex>) and URL sets
+// (<urlset>).
+type sitemapDocument struct {
+	XMLName  xml.Name
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+	URLs     []sitemapEntry `xml:"url"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+var productPageRe = regexp.MustCompile(`/([A-Z]{2}[0-9]{4})\.html$`)
+
+// sitemapsFromRobots returns the Sitemap: lines of a robots.txt.
+func sitemapsFromRobots(body []byte) []string {
+	var sitemaps []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			sitemaps = append(sitemaps, strings.TrimSpace(value))
+		}
+	}
+	return sitemaps
+}
+
+// parseLastMod normalizes a W3C datetime as used by sitemaps, which may be a
+// bare date, to RFC 3339 in UTC.
+func parseLastMod(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return ""
+}
+
+// decodeSitemap parses a sitemap, gunzipping it first when it is still
+// compressed. Sitemaps named *.xml.gz are usually served as files rather than
+// with Content-Encoding, so fetch hands them over as they are.
+func decodeSitemap(body []byte) (*sitemapDocument, error) {
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %v", err)
+		}
+		defer zr.Close()
+		if body, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap: %v", err)
+		}
+	}
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap: %v", err)
+	}
+	return &doc, nil
+}
+
+// discoverSitemaps collects the product pages listed in the given sitemaps,
+// or in the sitemaps named by robots.txt when there are none, following
+// sitemap indexes. Products are returned most recently modified first;
+// those without lastmod come last.
+func (s *ScrapingSession) discoverSitemaps(sitemapURLs []string) ([]sitemapProduct, error) {
+	if len(sitemapURLs) == 0 {
+		robotsURL := s.baseURL + "/robots.txt"
+		body, err := s.fetch(robotsURL, 3, requestOptions{dest: destDocument})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch robots.txt: %v", err)
+		}
+		sitemapURLs = sitemapsFromRobots(body)
+		slog.Info("Read sitemaps from robots.txt", "url", robotsURL, "sitemaps", len(sitemapURLs))
+		if len(sitemapURLs) == 0 {
+			sitemapURLs = []string{s.baseURL + "/sitemap.xml"}
+		}
+	}
+
+	products := make(map[string]sitemapProduct)
+	visited := make(map[string]bool)
+	read := 0
+	var visit func(sitemapURL string, depth int)
+	visit = func(sitemapURL string, depth int) {
+		if visited[sitemapURL] {
+			return
+		}
+		visited[sitemapURL] = true
+		body, err := s.fetch(sitemapURL, 3, requestOptions{dest: destDocument})
+		if err != nil {
+			slog.Error("Failed to fetch sitemap", "url", sitemapURL, "error", err)
+			return
+		}
+		doc, err := decodeSitemap(body)
+		if err != nil {
+			slog.Error("Failed to read sitemap", "url", sitemapURL, "error", err)
+			return
+		}
+		read++
+		if doc.XMLName.Local == "sitemapindex" {
+			slog.Info("Following sitemap index", "url", sitemapURL, "sitemaps", len(doc.Sitemaps))
+			if depth >= maxSitemapDepth {
+				slog.Warn("Sitemap indexes nested too deep", "url", sitemapURL)
+				return
+			}
+			for _, child := range doc.Sitemaps {
+				visit(strings.TrimSpace(child.Loc), depth+1)
+			}
+			return
+		}
+
+		found := 0
+		for _, entry := range doc.URLs {
+			loc := strings.TrimSpace(entry.Loc)
+			m := productPageRe.FindStringSubmatch(loc)
+			if m == nil {
+				continue
+			}
+			found++
+			p := sitemapProduct{ID: m[1], URL: loc, LastMod: parseLastMod(entry.LastMod)}
+			// A product listed twice keeps its latest modification.
+			if known, ok := products[p.ID]; !ok || p.LastMod > known.LastMod {
+				products[p.ID] = p
+			}
+		}
+		slog.Info("Read sitemap", "url", sitemapURL, "urls", len(doc.URLs), "products", found)
+	}
+	for _, sitemapURL := range sitemapURLs {
+		visit(strings.TrimSpace(sitemapURL), 0)
+	}
+	if read == 0 {
+		return nil, fmt.Errorf("none of the %d sitemaps could be read", len(visited))
+	}
+
+	list := make([]sitemapProduct, 0, len(products))
+	for _, p := range products {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LastMod != list[j].LastMod {
+			return list[i].LastMod > list[j].LastMod
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// loadLastMod reads the lastmod file written by saveLastMod. A missing file
+// yields an empty map.
+func loadLastMod(filename string) (map[string]sitemapProduct, error) {
+	products := make(map[string]sitemapProduct)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return products, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lastmod file: %v", err)
+	}
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("failed to parse lastmod file %s: %v", filename, err)
+	}
+	return products, nil
+}
+
+// saveLastMod merges products into the lastmod file, keyed by product ID.
+func saveLastMod(filename string, products []sitemapProduct) error {
+	known, err := loadLastMod(filename)
+	if err != nil {
+		return err
+	}
+	for _, p := range products {
+		known[p.ID] = p
+	}
+	data, err := json.MarshalIndent(known, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lastmod file: %v", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lastmod file: %v", err)
+	}
+	return nil
+}
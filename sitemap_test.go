@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverSitemaps(t *testing.T) {
+	for _, encoding := range []string{"", "gzip"} {
+		m := newMockAdidas(t)
+		m.encoding = encoding
+		session, _ := newMockSession(m, 0)
+		products, err := session.discoverSitemaps(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// KB5435 comes from the gzipped sitemap, whose links the mock does not
+		// rewrite.
+		want := []sitemapProduct{
+			{ID: "KB5435", URL: "https://www.adidas.jp/adicolor-oversized-tee/KB5435.html", LastMod: "2025-06-20T01:30:00Z"},
+			{ID: "IA4845", URL: m.URL() + "/adicolor-classics-3-stripes-tee/IA4845.html", LastMod: "2025-06-19T03:00:00Z"},
+			{ID: "KA9777", URL: m.URL() + "/y-3-regular-short-sleeve-tee/KA9777.html", LastMod: "2025-06-18T00:00:00Z"},
+			{ID: "JZ0717", URL: m.URL() + "/y-3-graphic-short-sleeve-tee/JZ0717.html"},
+		}
+		if !reflect.DeepEqual(products, want) {
+			t.Errorf("encoding %q: products = %+v, want %+v", encoding, products, want)
+		}
+		if got := m.requestCount("/robots.txt"); got != 1 {
+			t.Errorf("robots.txt requested %d times", got)
+		}
+	}
+}
+
+func TestSaveLastModMerges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lastmod.json")
+	if err := saveLastMod(file, []sitemapProduct{{ID: "IA4845", LastMod: "2025-06-01T00:00:00Z"}, {ID: "KB5435"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveLastMod(file, []sitemapProduct{{ID: "IA4845", LastMod: "2025-06-19T03:00:00Z"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadLastMod(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["IA4845"].LastMod != "2025-06-19T03:00:00Z" {
+		t.Errorf("lastmod file = %+v", got)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Size kinds.
+const (
+	sizeApparel  = "apparel"
+	sizeKids     = "kids"
+	sizeFootwear = "footwear"
+	sizeWaist    = "waist"
+	sizeUnknown  = "unknown"
+)
+
+// Size systems.
+const (
+	systemJP      = "JP"   // Japanese apparel (J/ prefix), also kids heights in cm
+	systemIntl    = "INTL" // letter sizes without a market prefix
+	systemCM      = "CM"   // foot length, as used for shoes in Japan
+	systemUK      = "UK"
+	systemUSMen   = "US-M"
+	systemUSWomen = "US-W"
+	systemEU      = "EU"
+	systemInch    = "INCH"
+)
+
+// Size is a parsed size label. Value is canonical within System: letter
+// sizes are written XS, S, M, L, XL, 2XL, ...; shoe sizes as decimals (or
+// with thirds for EU); waist and kids sizes as plain numbers.
+type Size struct {
+	Label       string            `json:"label"`
+	Kind        string            `json:"kind"`
+	System      string            `json:"system,omitempty"`
+	Value       string            `json:"value,omitempty"`
+	Length      string            `json:"length,omitempty"`      // inseam of waist sizes
+	Conversions map[string]string `json:"conversions,omitempty"` // footwear only, by system
+}
+
+var (
+	letterSizeRe = regexp.MustCompile(`^([2-6])?(X*)(S|M|L)$`)
+	jisLetterRe  = regexp.MustCompile(`^([2-6])?(X?)O$`)
+	kidsSizeRe   = regexp.MustCompile(`^(\d{2,3})$`)
+	cmSizeRe     = regexp.MustCompile(`^(\d{2}(?:\.\d)?)\s*CM$`)
+	bareCMRe     = regexp.MustCompile(`^(\d{2}\.[05])$`)
+	usSizeRe     = regexp.MustCompile(`^US\s*(M|W|MEN|WOMEN)?\s*(\d{1,2}(?:\.5)?)$`)
+	usPairRe     = regexp.MustCompile(`^M\s*(\d{1,2}(?:\.5)?)\s*/\s*W\s*(\d{1,2}(?:\.5)?)$`)
+	ukSizeRe     = regexp.MustCompile(`^UK\s*(\d{1,2}(?:\.5)?)$`)
+	euSizeRe     = regexp.MustCompile(`^(?:EU\s*)?(\d{2})(?:\s+([12])/3)?$`)
+	waistSizeRe  = regexp.MustCompile(`^W\s*(\d{2})(?:\s*[/X ]?\s*L\s*(\d{2}))?$`)
+	waistPairRe  = regexp.MustCompile(`^(\d{2})\s*X\s*(\d{2})$`)
+)
+
+// parseSize normalizes an adidas size label such as "J/2XS", "J/O",
+// "26.5cm", "UK 8½", "M 8 / W 9", "EU 42 2/3" or "W32 L30". Bare numbers
+// such as "42" (EU) or "26.5" (cm) are read as shoe sizes only for
+// footwear, since apparel uses plain numbers too. Labels it cannot place get Kind "unknown".
+func parseSize(label string, footwear bool) Size {
+	size := Size{Label: label, Kind: sizeUnknown}
+	s := strings.ToUpper(strings.TrimSpace(label))
+	s = strings.ReplaceAll(s, "½", ".5")
+	s = strings.ReplaceAll(s, " 1/2", ".5")
+	s = strings.ReplaceAll(s, "⅓", " 1/3")
+	s = strings.ReplaceAll(s, "⅔", " 2/3")
+
+	jp := strings.HasPrefix(s, "J/")
+	s = strings.TrimSpace(strings.TrimPrefix(s, "J/"))
+	letters := strings.NewReplacer("-", "", " ", "", "EXTRA", "X", "LARGE", "L", "SMALL", "S", "MEDIUM", "M").Replace(s)
+
+	switch {
+	case letterSizeRe.MatchString(letters):
+		size.Kind, size.Value = sizeApparel, canonicalLetterSize(letterSizeRe.FindStringSubmatch(letters))
+	case jp && jisLetterRe.MatchString(letters):
+		// JIS O (ōkii) is XL, XO 2XL, 2XO 3XL and so on.
+		m := jisLetterRe.FindStringSubmatch(letters)
+		n := 1
+		if m[2] == "X" {
+			n = 2
+		}
+		if m[1] != "" {
+			n, _ = strconv.Atoi(m[1])
+			n++
+		}
+		size.Kind, size.Value = sizeApparel, xSize(n, "L")
+	case jp && kidsSizeRe.MatchString(s):
+		size.Kind, size.System, size.Value = sizeKids, systemJP, s
+		return size
+	case waistSizeRe.MatchString(s):
+		m := waistSizeRe.FindStringSubmatch(s)
+		size.Kind, size.System, size.Value, size.Length = sizeWaist, systemInch, m[1], m[2]
+		return size
+	case waistPairRe.MatchString(s):
+		m := waistPairRe.FindStringSubmatch(s)
+		size.Kind, size.System, size.Value, size.Length = sizeWaist, systemInch, m[1], m[2]
+		return size
+	default:
+		return parseShoeSize(size, s, footwear)
+	}
+	size.System = systemIntl
+	if jp {
+		size.System = systemJP
+	}
+	return size
+}
+
+// canonicalLetterSize turns the submatches of letterSizeRe into the
+// canonical form: XXL and 2XL both become 2XL.
+func canonicalLetterSize(m []string) string {
+	n := len(m[2])
+	if m[1] != "" {
+		if n != 1 {
+			return m[0]
+		}
+		n, _ = strconv.Atoi(m[1])
+	}
+	if m[3] == "M" {
+		if n > 0 {
+			return m[0]
+		}
+		return "M"
+	}
+	return xSize(n, m[3])
+}
+
+func xSize(n int, base string) string {
+	switch n {
+	case 0:
+		return base
+	case 1:
+		return "X" + base
+	}
+	return fmt.Sprintf("%dX%s", n, base)
+}
+
+func parseShoeSize(size Size, s string, footwear bool) Size {
+	var system, value string
+	switch {
+	case cmSizeRe.MatchString(s):
+		system, value = systemCM, cmSizeRe.FindStringSubmatch(s)[1]
+	case bareCMRe.MatchString(s) && footwear:
+		system, value = systemCM, s
+	case usPairRe.MatchString(s):
+		system, value = systemUSMen, usPairRe.FindStringSubmatch(s)[1]
+	case usSizeRe.MatchString(s):
+		m := usSizeRe.FindStringSubmatch(s)
+		system, value = systemUSMen, m[2]
+		if strings.HasPrefix(m[1], "W") {
+			system = systemUSWomen
+		}
+	case ukSizeRe.MatchString(s):
+		system, value = systemUK, ukSizeRe.FindStringSubmatch(s)[1]
+	case euSizeRe.MatchString(s):
+		m := euSizeRe.FindStringSubmatch(s)
+		n, _ := strconv.Atoi(m[1])
+		bare := !strings.HasPrefix(s, "EU") && m[2] == ""
+		if n < 33 || n > 52 || bare && !footwear {
+			return size
+		}
+		system, value = systemEU, m[1]
+		if m[2] != "" {
+			value += " " + m[2] + "/3"
+		}
+	default:
+		return size
+	}
+	if system != systemEU {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return size
+		}
+		value = formatShoeSize(f, system)
+	}
+	size.Kind, size.System, size.Value = sizeFootwear, system, value
+	size.Conversions = convertShoeSize(system, value)
+	return size
+}
+
+func formatShoeSize(v float64, system string) string {
+	if system == systemCM {
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// footwearSize is one row of adidas' unisex shoe size chart.
+type footwearSize struct {
+	cm, uk, usMen, usWomen float64
+	eu                     string
+}
+
+// footwearSizes follows adidas' chart: UK sizes step with half a centimeter,
+// US men's sizes are UK plus a half, women's UK plus one and a half, and EU
+// sizes advance in thirds.
+var footwearSizes = func() []footwearSize {
+	var sizes []footwearSize
+	eu := 36 * 3 // in thirds
+	for i := 0; i <= 24; i++ {
+		uk := 3.5 + float64(i)*0.5
+		euValue := strconv.Itoa(eu / 3)
+		if eu%3 != 0 {
+			euValue += fmt.Sprintf(" %d/3", eu%3)
+		}
+		sizes = append(sizes, footwearSize{cm: 22 + float64(i)*0.5, uk: uk, usMen: uk + 0.5, usWomen: uk + 1.5, eu: euValue})
+		eu += 2
+	}
+	return sizes
+}()
+
+// convertShoeSize returns the size in every system of footwearSizes, or nil
+// when value is not on the chart.
+func convertShoeSize(system, value string) map[string]string {
+	for _, row := range footwearSizes {
+		var v string
+		switch system {
+		case systemCM:
+			v = formatShoeSize(row.cm, systemCM)
+		case systemUK:
+			v = formatShoeSize(row.uk, systemUK)
+		case systemUSMen:
+			v = formatShoeSize(row.usMen, systemUSMen)
+		case systemUSWomen:
+			v = formatShoeSize(row.usWomen, systemUSWomen)
+		case systemEU:
+			v = row.eu
+		}
+		if v == value {
+			return map[string]string{
+				systemCM:      formatShoeSize(row.cm, systemCM),
+				systemUK:      formatShoeSize(row.uk, systemUK),
+				systemUSMen:   formatShoeSize(row.usMen, systemUSMen),
+				systemUSWomen: formatShoeSize(row.usWomen, systemUSWomen),
+				systemEU:      row.eu,
+			}
+		}
+	}
+	return nil
+}
+
+// footwearCategories are the attribute_list.category values of shoes.
+var footwearCategories = []string{"シューズ", "靴", "FOOTWEAR", "SHOES"}
+
+// isFootwear reports whether category is a shoe category.
+func isFootwear(category string) bool {
+	category = strings.ToUpper(category)
+	for _, c := range footwearCategories {
+		if strings.Contains(category, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSizes parses every label of a product's size list; footwear
+// tells whether the product is a shoe, see parseSize.
+func normalizeSizes(labels []string, footwear bool) []Size {
+	var sizes []Size
+	for _, label := range labels {
+		sizes = append(sizes, parseSize(label, footwear))
+	}
+	return sizes
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		label string
+		want  Size
+	}{
+		{"J/2XS", Size{Kind: sizeApparel, System: systemJP, Value: "2XS"}},
+		{"J/XXL", Size{Kind: sizeApparel, System: systemJP, Value: "2XL"}},
+		{"J/L", Size{Kind: sizeApparel, System: systemJP, Value: "L"}},
+		{"J/5XL", Size{Kind: sizeApparel, System: systemJP, Value: "5XL"}},
+		{"J/XO", Size{Kind: sizeApparel, System: systemJP, Value: "2XL"}},
+		{"Extra Large", Size{Kind: sizeApparel, System: systemIntl, Value: "XL"}},
+		{"J/140", Size{Kind: sizeKids, System: systemJP, Value: "140"}},
+		{"W32 L30", Size{Kind: sizeWaist, System: systemInch, Value: "32", Length: "30"}},
+		{"J/W28", Size{Kind: sizeWaist, System: systemInch, Value: "28"}},
+		{"26.5cm", Size{Kind: sizeFootwear, System: systemCM, Value: "26.5"}},
+		{"UK 8½", Size{Kind: sizeFootwear, System: systemUK, Value: "8.5"}},
+		{"M 8 / W 9", Size{Kind: sizeFootwear, System: systemUSMen, Value: "8"}},
+		{"US W 9.5", Size{Kind: sizeFootwear, System: systemUSWomen, Value: "9.5"}},
+		{"EU 42 2/3", Size{Kind: sizeFootwear, System: systemEU, Value: "42 2/3"}},
+		{"EU 42", Size{Kind: sizeFootwear, System: systemEU, Value: "42"}},
+		{"ONE SIZE", Size{Kind: sizeUnknown}},
+		// Bare numbers are not EU sizes unless the product is a shoe.
+		{"42", Size{Kind: sizeUnknown}},
+		{"26.5", Size{Kind: sizeUnknown}},
+	}
+	for _, tt := range tests {
+		got := parseSize(tt.label, false)
+		got.Conversions = nil
+		tt.want.Label = tt.label
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSize(%q) = %+v, want %+v", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestConvertShoeSize(t *testing.T) {
+	want := map[string]string{systemCM: "27.0", systemUK: "8.5", systemUSMen: "9", systemUSWomen: "10", systemEU: "42 2/3"}
+	for _, label := range []string{"27cm", "UK 8 1/2", "US 9", "US W10", "42 2/3"} {
+		if got := parseSize(label, true).Conversions; !reflect.DeepEqual(got, want) {
+			t.Errorf("conversions of %q = %v, want %v", label, got, want)
+		}
+	}
+	if got := parseSize("UK 20", true).Conversions; got != nil {
+		t.Errorf("conversions of a size off the chart = %v, want none", got)
+	}
+}
+
+func TestNormalizeSizesOfApparel(t *testing.T) {
+	labels := []string{"34", "36", "38", "40"}
+	if !isFootwear("シューズ・靴") || isFootwear("ウェア・服") {
+		t.Fatal("isFootwear misclassifies the adidas.jp categories")
+	}
+	for _, size := range normalizeSizes(labels, isFootwear("ウェア・服")) {
+		if size.Kind == sizeFootwear {
+			t.Errorf("apparel size %q parsed as %+v", size.Label, size)
+		}
+	}
+	for _, size := range normalizeSizes(labels, isFootwear("シューズ・靴")) {
+		if size.Kind != sizeFootwear || size.System != systemEU || size.Value != size.Label {
+			t.Errorf("shoe size %q parsed as %+v", size.Label, size)
+		}
+	}
+	if size := parseSize("26.5", true); size.System != systemCM || size.Value != "26.5" {
+		t.Errorf("bare cm shoe size parsed as %+v", size)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultTaxonomySeeds are the gender landing pages the category crawl starts
+// from.
+var defaultTaxonomySeeds = []string{"/メンズ", "/レディース", "/キッズ"}
+
+// Category is one storefront category listing.
+type Category struct {
+	Name   string   `json:"name"`
+	Path   string   `json:"path"`             // storefront path, e.g. /メンズ-tシャツ
+	Trail  []string `json:"trail,omitempty"`  // names from the gender down, e.g. メンズ, ウェア・服, Tシャツ
+	Parent string   `json:"parent,omitempty"` // path of the parent category
+	Labels []string `json:"labels,omitempty"` // texts of the links to it, e.g. メンズTシャツ
+}
+
+// categoryTaxonomy is the category tree of the storefront as found by
+// crawlTaxonomy.
+type categoryTaxonomy struct {
+	Categories []Category `json:"categories"`
+	byPath     map[string]int
+}
+
+func newCategoryTaxonomy() *categoryTaxonomy {
+	return &categoryTaxonomy{byPath: make(map[string]int)}
+}
+
+// add records a category, merging it into what is known about its path.
+func (t *categoryTaxonomy) add(c Category) {
+	i, ok := t.byPath[c.Path]
+	if !ok {
+		t.byPath[c.Path] = len(t.Categories)
+		t.Categories = append(t.Categories, c)
+		return
+	}
+	known := &t.Categories[i]
+	if len(c.Trail) > len(known.Trail) {
+		known.Name, known.Trail, known.Parent = c.Name, c.Trail, c.Parent
+	}
+	for _, label := range c.Labels {
+		if !containsString(known.Labels, label) {
+			known.Labels = append(known.Labels, label)
+		}
+	}
+}
+
+// find returns the categories called name. A name matches the category
+// name, one of its link labels or its trail joined with " > " or "/", ignoring
+// case and spaces.
+func (t *categoryTaxonomy) find(name string) []Category {
+	key := categoryKey(name)
+	var found []Category
+	for _, c := range t.Categories {
+		candidates := append([]string{c.Name, strings.Join(c.Trail, ">"), strings.Join(c.Trail, "/")}, c.Labels...)
+		for _, candidate := range candidates {
+			if candidate != "" && categoryKey(candidate) == key {
+				found = append(found, c)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func categoryKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
+
+// trailOf returns the trail of the only category called name, or nil when
+// the taxonomy is nil or the name is unknown or ambiguous (ウェア・服 exists
+// for every gender).
+func (t *categoryTaxonomy) trailOf(name string) []string {
+	if t == nil || name == "" {
+		return nil
+	}
+	var trail []string
+	for _, c := range t.Categories {
+		if c.Name == name && len(c.Trail) > 0 {
+			if trail != nil {
+				return nil
+			}
+			trail = c.Trail
+		}
+	}
+	return trail
+}
+
+// text renders the taxonomy as an indented tree, followed by the categories
+// that were linked but never crawled.
+func (t *categoryTaxonomy) text() string {
+	children := make(map[string][]Category)
+	var unplaced []Category
+	for _, c := range t.Categories {
+		switch {
+		case len(c.Trail) == 0:
+			unplaced = append(unplaced, c)
+		case len(c.Trail) == 1:
+			children[""] = append(children[""], c)
+		default:
+			children[c.Parent] = append(children[c.Parent], c)
+		}
+	}
+	var b strings.Builder
+	var walk func(parent string, depth int)
+	walk = func(parent string, depth int) {
+		list := children[parent]
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		for _, c := range list {
+			fmt.Fprintf(&b, "%s%s  %s\n", strings.Repeat("  ", depth), c.Name, c.Path)
+			walk(c.Path, depth+1)
+		}
+	}
+	walk("", 0)
+	if len(unplaced) > 0 {
+		b.WriteString("Not crawled:\n")
+		sort.Slice(unplaced, func(i, j int) bool { return unplaced[i].Path < unplaced[j].Path })
+		for _, c := range unplaced {
+			fmt.Fprintf(&b, "  %s  %s\n", c.Name, c.Path)
+		}
+	}
+	return b.String()
+}
+
+func (t *categoryTaxonomy) save(filename string) error {
+	sort.Slice(t.Categories, func(i, j int) bool { return t.Categories[i].Path < t.Categories[j].Path })
+	for i, c := range t.Categories {
+		t.byPath[c.Path] = i
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode categories: %v", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write categories: %v", err)
+	}
+	return nil
+}
+
+// loadTaxonomy reads a file written by save. A missing file yields nil.
+func loadTaxonomy(filename string) (*categoryTaxonomy, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read categories: %v", err)
+	}
+	t := newCategoryTaxonomy()
+	var stored categoryTaxonomy
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse categories %s: %v", filename, err)
+	}
+	for _, c := range stored.Categories {
+		t.add(c)
+	}
+	return t, nil
+}
+
+var (
+	breadcrumbListRe = regexp.MustCompile(`(?s)<ol[^>]*schema\.org/BreadcrumbList[^>]*>(.*?)</ol>`)
+	breadcrumbItemRe = regexp.MustCompile(`(?s)<li[^>]*itemProp="itemListElement"[^>]*>(.*?)</li>`)
+	itemHrefRe       = regexp.MustCompile(`href="([^"]*)"`)
+	itemNameRe       = regexp.MustCompile(`itemProp="name"[^>]*>([^<]*)<`)
+	plpLinkRe        = regexp.MustCompile(`<a[^>]*data-testid="plp-link"[^>]*href="([^"]*)"[^>]*>([^<]*)</a>`)
+)
+
+// categoryLink is a link to a category listing.
+type categoryLink struct {
+	Path string
+	Text string
+}
+
+// categoryPath returns the decoded path of a category link, which may be
+// absolute, relative or percent-encoded.
+func categoryPath(href string) string {
+	u, err := url.Parse(html.UnescapeString(href))
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// parseCategoryPage extracts the breadcrumb trail of a listing page, Home
+// excluded, and the links to related category listings. The last crumb is
+// the page itself and has no path.
+func parseCategoryPage(body string) ([]categoryLink, []categoryLink) {
+	var crumbs []categoryLink
+	if m := breadcrumbListRe.FindStringSubmatch(body); m != nil {
+		for _, item := range breadcrumbItemRe.FindAllStringSubmatch(m[1], -1) {
+			name := itemNameRe.FindStringSubmatch(item[1])
+			if name == nil {
+				continue
+			}
+			crumb := categoryLink{Text: strings.TrimSpace(html.UnescapeString(name[1]))}
+			if href := itemHrefRe.FindStringSubmatch(item[1]); href != nil {
+				crumb.Path = categoryPath(href[1])
+			}
+			if crumb.Path == "/" {
+				continue
+			}
+			crumbs = append(crumbs, crumb)
+		}
+	}
+	var links []categoryLink
+	for _, m := range plpLinkRe.FindAllStringSubmatch(body, -1) {
+		if path := categoryPath(m[1]); path != "" && path != "/" {
+			links = append(links, categoryLink{Path: path, Text: strings.TrimSpace(html.UnescapeString(m[2]))})
+		}
+	}
+	return crumbs, links
+}
+
+// crawlTaxonomy fetches category listings starting at the seed paths and
+// following their category links, up to maxPages pages, and builds the
+// category tree from their breadcrumbs. Categories that are linked but not
+// fetched are kept without a trail so they can still be selected by name.
+func (s *ScrapingSession) crawlTaxonomy(seeds []string, maxPages int) (*categoryTaxonomy, error) {
+	t := newCategoryTaxonomy()
+	queued := make(map[string]bool)
+	var queue []string
+	enqueue := func(path string) {
+		if !queued[path] {
+			queued[path] = true
+			queue = append(queue, path)
+		}
+	}
+	for _, seed := range seeds {
+		enqueue(categoryPath(seed))
+	}
+
+	fetched := 0
+	for len(queue) > 0 && fetched < maxPages {
+		path := queue[0]
+		queue = queue[1:]
+		pageURL := s.baseURL + path
+		body, err := s.fetch(pageURL, 3, requestOptions{dest: destDocument})
+		fetched++
+		if err != nil {
+			slog.Error("Failed to fetch category page", "url", pageURL, "error", err)
+			continue
+		}
+		crumbs, links := parseCategoryPage(string(body))
+		var trail []string
+		parent := ""
+		for i, crumb := range crumbs {
+			trail = append(trail, crumb.Text)
+			crumbPath := crumb.Path
+			if i == len(crumbs)-1 {
+				crumbPath = path
+			}
+			if crumbPath == "" {
+				continue
+			}
+			t.add(Category{Name: crumb.Text, Path: crumbPath, Trail: append([]string(nil), trail...), Parent: parent})
+			parent = crumbPath
+		}
+		for _, link := range links {
+			t.add(Category{Name: link.Text, Path: link.Path, Labels: []string{link.Text}})
+			enqueue(link.Path)
+		}
+		slog.Info("Scraped category page", "url", pageURL, "trail", strings.Join(trail, " > "), "links", len(links))
+	}
+	if len(queue) > 0 {
+		slog.Warn("Stopped category crawl at the page limit", "pages", maxPages, "unvisited", len(queue))
+	}
+	if len(t.Categories) == 0 {
+		return nil, fmt.Errorf("no categories found on %d pages", fetched)
+	}
+	return t, nil
+}
+
+// selectCategories resolves category names against the taxonomy in filename
+// and returns the listing URLs of the matching categories under baseURL.
+func selectCategories(filename string, names []string, baseURL string) ([]string, error) {
+	taxonomy, err := loadTaxonomy(filename)
+	if err != nil {
+		return nil, err
+	}
+	if taxonomy == nil {
+		return nil, fmt.Errorf("no category tree in %s; run the categories command first", filename)
+	}
+	var urls []string
+	for _, name := range names {
+		found := taxonomy.find(name)
+		if len(found) == 0 {
+			return nil, fmt.Errorf("unknown category %q", name)
+		}
+		for _, c := range found {
+			u := baseURL + c.Path
+			if !containsString(urls, u) {
+				urls = append(urls, u)
+			}
+			slog.Info("Selected category", "name", name, "trail", strings.Join(c.Trail, " > "), "url", u)
+		}
+	}
+	return urls, nil
+}
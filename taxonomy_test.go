@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCrawlTaxonomy(t *testing.T) {
+	m := newMockAdidas(t)
+	session, _ := newMockSession(m, 0)
+	taxonomy, err := session.crawlTaxonomy([]string{"/メンズ-tシャツ"}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tees := taxonomy.find("メンズ/ウェア・服/Tシャツ")
+	if len(tees) != 1 || tees[0].Path != "/メンズ-tシャツ" || tees[0].Parent != "/メンズ-ウェア・服" {
+		t.Fatalf("find(メンズ/ウェア・服/Tシャツ) = %+v", tees)
+	}
+	polos := taxonomy.find("メンズ ポロシャツ")
+	if len(polos) != 1 || len(polos[0].Trail) != 3 {
+		t.Errorf("find(メンズ ポロシャツ) = %+v, want the crawled polo shirt listing", polos)
+	}
+	if got := taxonomy.trailOf("Tシャツ"); !reflect.DeepEqual(got, []string{"メンズ", "ウェア・服", "Tシャツ"}) {
+		t.Errorf("trailOf(Tシャツ) = %q", got)
+	}
+	if caps := taxonomy.find("メンズ帽子"); len(caps) != 1 || caps[0].Trail != nil {
+		t.Errorf("find(メンズ帽子) = %+v, want a linked category without trail", caps)
+	}
+	if got := m.requestCount("/メンズ-tシャツ"); got != 1 {
+		t.Errorf("T-shirt listing fetched %d times", got)
+	}
+	if !strings.Contains(taxonomy.text(), "メンズ  /メンズ\n  ウェア・服  /メンズ-ウェア・服\n    Tシャツ  /メンズ-tシャツ\n") {
+		t.Errorf("tree:\n%s", taxonomy.text())
+	}
+
+	file := filepath.Join(t.TempDir(), "categories.json")
+	if err := taxonomy.save(file); err != nil {
+		t.Fatal(err)
+	}
+	urls, err := selectCategories(file, []string{"tシャツ", "メンズジャージ"}, m.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{m.URL() + "/メンズ-tシャツ", m.URL() + "/メンズ-ジャージ"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("selectCategories = %q, want %q", urls, want)
+	}
+	if _, err := selectCategories(file, []string{"スカート"}, m.URL()); err == nil {
+		t.Error("selecting an unknown category succeeded")
+	}
+
+	out := outputConfig{taxonomy: file}
+	enrich, err := out.enricher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &ProductData{ID: "IA4845", Category: "Tシャツ"}
+	enrich(p)
+	if want := []string{"メンズ", "ウェア・服", "Tシャツ"}; !reflect.DeepEqual(p.CategoryPath, want) {
+		t.Errorf("CategoryPath without breadcrumbs = %q, want %q", p.CategoryPath, want)
+	}
+}